@@ -0,0 +1,122 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Package api holds the request and response bodies of the rendering service
+// served by the server package, so that clients can speak its protocol
+// without linking the server.
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+// RenderRequest is the body of POST /pdf and POST /image. Exactly one of URL,
+// HTML and Bundle must be given.
+//
+// The same fields can be sent as multipart/form-data, where a bundle can also
+// be uploaded as individual "files" parts whose file names are their paths
+// within the bundle.
+type RenderRequest struct {
+	URL     string          `json:"url,omitempty"`     // Page to render, http or https only
+	HTML    string          `json:"html,omitempty"`    // Document to render
+	Bundle  []byte          `json:"bundle,omitempty"`  // Zip archive of a document and its assets
+	Entry   string          `json:"entry,omitempty"`   // File in Bundle to render, wkhtmltox.DefaultBundleEntry if empty
+	Options json.RawMessage `json:"options,omitempty"` // PDFOptions or ImageOptions, except allow, cache_dir and local_file_access
+}
+
+// Types of error reported in an ErrorResponse
+const (
+	ErrorTypeUnsafeArgument = "unsafe_argument" // A *wkhtmltox.UnsafeArgumentError
+	ErrorTypeExit           = "exit"            // A *wkhtmltox.ExitError
+	ErrorTypeTimeout        = "timeout"         // The conversion ran out of time
+	ErrorTypeBundle         = "bundle"          // A *wkhtmltox.BundleError
+	ErrorTypeOutput         = "output"          // A *wkhtmltox.OutputError
+)
+
+// ErrorResponse is the body of every unsuccessful response. The fields after
+// Error describe the error in enough detail to rebuild it, when its Type is
+// known.
+type ErrorResponse struct {
+	Error    string `json:"error"`
+	Type     string `json:"type,omitempty"`      // One of the ErrorType constants
+	Name     string `json:"name,omitempty"`      // Unsafe flag or argument, rejected bundle file, or output problem
+	Value    string `json:"value,omitempty"`     // Its value
+	Reason   string `json:"reason,omitempty"`    // Why it was rejected
+	Binary   string `json:"binary,omitempty"`    // Converter that exited
+	ExitCode int    `json:"exit_code,omitempty"` // Its exit status
+}
+
+// JobState is the lifecycle stage of an asynchronous job
+type JobState string
+
+// States an asynchronous job moves through
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCanceled  JobState = "canceled"
+)
+
+// Finished reports whether a job in this state will not change again
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCanceled
+}
+
+// JobRequest is the body of POST /jobs
+type JobRequest struct {
+	Kind        wkhtmltox.ConverterKind `json:"kind"`                   // "pdf" or "image"
+	CallbackURL string                  `json:"callback_url,omitempty"` // Sent a WebhookPayload when the job finishes
+	RenderRequest
+}
+
+// JobStatus is the body of POST /jobs and GET /jobs/{id}
+type JobStatus struct {
+	ID         string                  `json:"id"`
+	Kind       wkhtmltox.ConverterKind `json:"kind"`
+	State      JobState                `json:"state"`
+	Progress   int                     `json:"progress"` // Percentage reported by the converter
+	Error      string                  `json:"error,omitempty"`
+	Failure    *ErrorResponse          `json:"failure,omitempty"` // Details of Error
+	Warnings   []string                `json:"warnings,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time              `json:"expires_at,omitempty"` // When the job and its result are forgotten
+	Deliveries []DeliveryAttempt       `json:"deliveries,omitempty"` // Attempts to call the callback URL
+}
+
+// DeliveryAttempt records one attempt to deliver a webhook
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"` // Zero if no response was received
+	Error      string    `json:"error,omitempty"`
+}
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body
+const SignatureHeader = "X-Wkhtmltox-Signature"
+
+// WebhookPayload is the body POSTed to a job's callback URL when it finishes
+type WebhookPayload struct {
+	JobID     string   `json:"job_id"`
+	State     JobState `json:"state"`
+	Error     string   `json:"error,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	ResultURL string   `json:"result_url,omitempty"` // Set when the job succeeded
+}
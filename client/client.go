@@ -0,0 +1,384 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Package client calls the rendering service served by the server package.
+//
+// A Client implements wkhtmltox.Renderer, so code written against that
+// interface can switch between wkhtmltox.LocalRenderer and the service by
+// changing one line. Local files are uploaded, and a zip archive is uploaded
+// as a bundle so the assets it holds resolve. Errors the service reports are
+// rebuilt as the same types that running the converter locally returns:
+// *UnsafeArgumentError, *ExitError and context.DeadlineExceeded can all be
+// matched with errors.As and errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/api"
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+// DefaultPollInterval is used when Client.PollInterval is zero
+const DefaultPollInterval = time.Second
+
+// Client renders documents using a remote rendering service
+type Client struct {
+	BaseURL      string        // Where the service is served, such as "http://localhost:8080"
+	HTTPClient   *http.Client  // nil for http.DefaultClient
+	Async        bool          // Render through the job endpoints instead of a single request
+	PollInterval time.Duration // How often Wait polls a job, DefaultPollInterval if zero
+}
+
+// New returns a Client for the service at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+var _ wkhtmltox.Renderer = (*Client)(nil)
+
+// Error is returned when the service answers with an error or a job fails.
+// It unwraps to the typed error the service described, if any.
+type Error struct {
+	StatusCode int    // HTTP status, zero for a failed job
+	JobID      string // Job that failed, if any
+	Message    string // Error reported by the service
+	err        error
+}
+
+func (e *Error) Error() string {
+	if e.JobID != "" {
+		return fmt.Sprintf("client: job %s: %s", e.JobID, e.Message)
+	}
+
+	return fmt.Sprintf("client: %s (status %d)", e.Message, e.StatusCode)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// newError rebuilds the error described by resp
+func newError(statusCode int, jobID string, resp api.ErrorResponse) *Error {
+	e := &Error{StatusCode: statusCode, JobID: jobID, Message: resp.Error}
+
+	switch resp.Type {
+	case api.ErrorTypeUnsafeArgument:
+		e.err = &wkhtmltox.UnsafeArgumentError{Name: resp.Name, Value: resp.Value, Reason: resp.Reason}
+	case api.ErrorTypeExit:
+		e.err = &wkhtmltox.ExitError{Binary: resp.Binary, Code: resp.ExitCode}
+	case api.ErrorTypeTimeout:
+		e.err = context.DeadlineExceeded
+	case api.ErrorTypeBundle:
+		e.err = &wkhtmltox.BundleError{Name: resp.Name, Reason: resp.Reason}
+	case api.ErrorTypeOutput:
+		e.err = &wkhtmltox.OutputError{Problem: wkhtmltox.OutputProblem(resp.Name), Reason: resp.Reason}
+	}
+
+	return e
+}
+
+// JobOptions are the optional settings of a submitted job
+type JobOptions struct {
+	IdempotencyKey string // Resubmitting with the same key returns the original job
+	CallbackURL    string // Sent a api.WebhookPayload when the job finishes
+}
+
+// renderRequest builds the request for inputURL, which is classified as
+// wkhtmltox.ResolveInput does so that the service and a LocalRenderer treat
+// it alike. URLs are fetched by the service. A local file ending in ".zip" is
+// sent as a bundle whose index.html is rendered. Any other local file is sent
+// inline as HTML, so assets it links to by relative path are not available.
+func renderRequest(inputURL string, opts interface{}) (api.RenderRequest, error) {
+	var req api.RenderRequest
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return req, err
+	}
+	req.Options = options
+
+	resolved, local, err := wkhtmltox.ResolveInput(inputURL)
+	if err != nil {
+		return req, err
+	}
+	if !local {
+		req.URL = resolved
+		return req, nil
+	}
+
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return req, err
+	}
+
+	if strings.EqualFold(filepath.Ext(resolved), ".zip") {
+		req.Bundle = data
+	} else {
+		req.HTML = string(data)
+	}
+
+	return req, nil
+}
+
+// PDF renders inputURL to a PDF
+func (c *Client) PDF(ctx context.Context, inputURL string, opts *wkhtmltox.PDFOptions) (*wkhtmltox.Result, error) {
+	if opts == nil {
+		opts = &wkhtmltox.PDFOptions{}
+	}
+
+	return c.render(ctx, wkhtmltox.PDFConverter, inputURL, opts)
+}
+
+// Image renders inputURL to an image, a PNG unless opts sets another Format
+func (c *Client) Image(ctx context.Context, inputURL string, opts *wkhtmltox.ImageOptions) (*wkhtmltox.Result, error) {
+	if opts == nil {
+		opts = &wkhtmltox.ImageOptions{}
+	}
+
+	return c.render(ctx, wkhtmltox.ImageConverter, inputURL, opts)
+}
+
+func (c *Client) render(ctx context.Context, kind wkhtmltox.ConverterKind, inputURL string, opts interface{}) (*wkhtmltox.Result, error) {
+	if c.Async {
+		status, err := c.submit(ctx, kind, inputURL, opts, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := c.Wait(ctx, status.ID)
+		if ctx.Err() != nil {
+			// Stop the job rather than leave it running for nobody
+			c.CancelJob(context.Background(), status.ID)
+		}
+
+		return result, err
+	}
+
+	req, err := renderRequest(inputURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/"+string(kind), req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return readResult(resp)
+}
+
+// SubmitPDF starts a job that renders inputURL to a PDF. jobOpts may be nil.
+func (c *Client) SubmitPDF(ctx context.Context, inputURL string, opts *wkhtmltox.PDFOptions, jobOpts *JobOptions) (api.JobStatus, error) {
+	if opts == nil {
+		opts = &wkhtmltox.PDFOptions{}
+	}
+
+	return c.submit(ctx, wkhtmltox.PDFConverter, inputURL, opts, jobOpts)
+}
+
+// SubmitImage starts a job that renders inputURL to an image. jobOpts may be
+// nil.
+func (c *Client) SubmitImage(ctx context.Context, inputURL string, opts *wkhtmltox.ImageOptions, jobOpts *JobOptions) (api.JobStatus, error) {
+	if opts == nil {
+		opts = &wkhtmltox.ImageOptions{}
+	}
+
+	return c.submit(ctx, wkhtmltox.ImageConverter, inputURL, opts, jobOpts)
+}
+
+func (c *Client) submit(ctx context.Context, kind wkhtmltox.ConverterKind, inputURL string, opts interface{}, jobOpts *JobOptions) (api.JobStatus, error) {
+	var status api.JobStatus
+
+	rr, err := renderRequest(inputURL, opts)
+	if err != nil {
+		return status, err
+	}
+
+	req := api.JobRequest{Kind: kind, RenderRequest: rr}
+	header := http.Header{}
+	if jobOpts != nil {
+		req.CallbackURL = jobOpts.CallbackURL
+		if jobOpts.IdempotencyKey != "" {
+			header.Set("Idempotency-Key", jobOpts.IdempotencyKey)
+		}
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/jobs", req, header)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+
+	return status, err
+}
+
+// Job returns the status of a job
+func (c *Client) Job(ctx context.Context, id string) (api.JobStatus, error) {
+	var status api.JobStatus
+
+	resp, err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+
+	return status, err
+}
+
+// JobResult downloads the result of a job that has succeeded
+func (c *Client) JobResult(ctx context.Context, id string) (*wkhtmltox.Result, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id)+"/result", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return readResult(resp)
+}
+
+// CancelJob cancels a job and discards its result
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Wait polls a job until it finishes and returns its result. A job that
+// failed or was canceled is reported as an *Error.
+func (c *Client) Wait(ctx context.Context, id string) (*wkhtmltox.Result, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch status.State {
+		case api.JobSucceeded:
+			return c.JobResult(ctx, id)
+		case api.JobFailed:
+			failure := api.ErrorResponse{Error: status.Error}
+			if status.Failure != nil {
+				failure = *status.Failure
+			}
+			return nil, newError(0, id, failure)
+		case api.JobCanceled:
+			return nil, newError(0, id, api.ErrorResponse{Error: "job was canceled"})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// do sends a request with body encoded as JSON, returning an *Error for
+// unsuccessful responses
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var errResp api.ErrorResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&errResp); err != nil || errResp.Error == "" {
+		errResp = api.ErrorResponse{Error: resp.Status}
+	}
+
+	return nil, newError(resp.StatusCode, "", errResp)
+}
+
+// readResult reads a rendered document from a successful response. PDFs are
+// inspected here, as LocalRenderer does, so results are the same either way.
+func readResult(resp *http.Response) (*wkhtmltox.Result, error) {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &wkhtmltox.Result{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+		Warnings:    resp.Header.Values("X-Wkhtmltox-Warning"),
+	}
+	if result.ContentType == "application/pdf" {
+		if result.PDF, err = wkhtmltox.ReadPDFInfo(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,235 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/client"
+	"github.com/itskingori/go-wkhtml/server"
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func newService(t *testing.T, cfg server.Config) *client.Client {
+	t.Helper()
+
+	cfg.Logger = log.New(io.Discard, "", 0)
+	srv := httptest.NewServer(server.New(cfg))
+	t.Cleanup(srv.Close)
+
+	c := client.New(srv.URL)
+	c.PollInterval = 10 * time.Millisecond
+
+	return c
+}
+
+func TestClientPDF(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{
+		OutputFile: wkhtmltoxtest.PDF(1),
+		Stderr:     []byte("Warning: slow\n"),
+	})
+	c := newService(t, server.Config{Executor: ex})
+
+	title := "Report"
+	for _, async := range []bool{false, true} {
+		c.Async = async
+
+		result, err := c.PDF(context.Background(), "https://example.com", &wkhtmltox.PDFOptions{Title: &title})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if string(result.Data) != string(wkhtmltoxtest.PDF(1)) || result.ContentType != "application/pdf" || len(result.Warnings) != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+
+	for _, call := range ex.Calls() {
+		if args := call.Args; args[len(args)-4] != "--title" || args[len(args)-3] != "Report" || args[len(args)-2] != "https://example.com" {
+			t.Fatalf("unexpected arguments '%s'", call.Args)
+		}
+	}
+}
+
+func TestClientImageFromFile(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.JPEG(8, 8)})
+	c := newService(t, server.Config{Executor: ex})
+
+	input := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(input, []byte("<p>hello</p>"), 0644)
+
+	format := "jpg"
+	result, err := c.Image(context.Background(), input, &wkhtmltox.ImageOptions{Format: &format})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if string(result.Data) != string(wkhtmltoxtest.JPEG(8, 8)) || result.ContentType != "image/jpeg" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(
+		wkhtmltoxtest.Response{ExitCode: 2},
+		wkhtmltoxtest.Response{ExitCode: 2},
+		wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(0)},
+		wkhtmltoxtest.Response{Delay: time.Minute},
+	)
+	c := newService(t, server.Config{Executor: ex, Timeout: 10 * time.Millisecond, JobTimeout: 10 * time.Millisecond})
+
+	for _, async := range []bool{false, true} {
+		c.Async = async
+
+		var exitErr *wkhtmltox.ExitError
+		_, err := c.PDF(context.Background(), "https://example.com", nil)
+		if !errors.As(err, &exitErr) || exitErr.Code != 2 || exitErr.Binary != "wkhtmltopdf" {
+			t.Fatalf("expected an *ExitError, got %v", err)
+		}
+	}
+
+	c.Async = false
+	title := "--evil"
+	var unsafeErr *wkhtmltox.UnsafeArgumentError
+	_, err := c.PDF(context.Background(), "https://example.com", &wkhtmltox.PDFOptions{Title: &title})
+	if !errors.As(err, &unsafeErr) || unsafeErr.Name != "title" || unsafeErr.Value != title {
+		t.Fatalf("expected an *UnsafeArgumentError, got %v", err)
+	}
+
+	var outputErr *wkhtmltox.OutputError
+	_, err = c.PDF(context.Background(), "https://example.com", nil)
+	if !errors.As(err, &outputErr) || outputErr.Problem != wkhtmltox.NoPages {
+		t.Fatalf("expected an *OutputError, got %v", err)
+	}
+
+	_, err = c.PDF(context.Background(), "https://example.com", nil)
+	var clientErr *client.Error
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &clientErr) || clientErr.StatusCode != 504 {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestClientJobs(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	c := newService(t, server.Config{Executor: ex})
+	ctx := context.Background()
+
+	jobOpts := &client.JobOptions{IdempotencyKey: "monthly-report"}
+	first, err := c.SubmitPDF(ctx, "https://example.com", nil, jobOpts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	again, err := c.SubmitPDF(ctx, "https://example.com", nil, jobOpts)
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("expected the first job, got %+v, %v", again, err)
+	}
+
+	result, err := c.Wait(ctx, first.ID)
+	if err != nil || string(result.Data) != string(wkhtmltoxtest.PDF(1)) {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+
+	if err := c.CancelJob(ctx, first.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var clientErr *client.Error
+	if _, err := c.Job(ctx, first.ID); !errors.As(err, &clientErr) || clientErr.StatusCode != 404 {
+		t.Fatalf("expected status 404, got %v", err)
+	}
+}
+
+func TestRendererSwitch(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+
+	for _, r := range []wkhtmltox.Renderer{
+		wkhtmltox.LocalRenderer{Executor: ex},
+		newService(t, server.Config{Executor: ex}),
+	} {
+		result, err := r.PDF(context.Background(), "https://example.com", nil)
+		if err != nil || string(result.Data) != string(wkhtmltoxtest.PDF(1)) || result.ContentType != "application/pdf" {
+			t.Fatalf("unexpected result from %T: %+v, %v", r, result, err)
+		}
+	}
+}
+
+func TestClientSchemelessInput(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	c := newService(t, server.Config{Executor: ex})
+
+	// Not a file here, so it is a URL to both renderers rather than read
+	if _, err := c.PDF(context.Background(), "localhost:8080/page", nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if args := ex.Calls()[0].Args; args[len(args)-2] != "http://localhost:8080/page" {
+		t.Fatalf("expected the input to be fetched as a URL, got '%s'", args)
+	}
+
+	var unsafeErr *wkhtmltox.UnsafeArgumentError
+	if _, err := c.PDF(context.Background(), "javascript:alert(1)", nil); !errors.As(err, &unsafeErr) {
+		t.Fatalf("expected an *UnsafeArgumentError, got %v", err)
+	}
+}
+
+func TestClientZipBundle(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	c := newService(t, server.Config{Executor: ex})
+	dir := t.TempDir()
+
+	write := func(name string, files ...string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, file := range files {
+			f, _ := zw.Create(file)
+			f.Write([]byte("<p>hi</p>"))
+		}
+		zw.Close()
+
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, buf.Bytes(), 0644)
+		return path
+	}
+
+	if _, err := c.PDF(context.Background(), write("site.zip", "index.html", "img/logo.png"), nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if args := ex.Calls()[0].Args; !strings.HasSuffix(args[len(args)-2], "index.html") {
+		t.Fatalf("unexpected arguments '%s'", args)
+	}
+
+	var bundleErr *wkhtmltox.BundleError
+	_, err := c.PDF(context.Background(), write("evil.zip", "../index.html"), nil)
+	if !errors.As(err, &bundleErr) || bundleErr.Name != "../index.html" {
+		t.Fatalf("expected a *BundleError, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Command wkhtml-doctor checks that a host can run wkhtmltopdf and
+// wkhtmltoimage, and suggests fixes for whatever is missing.
+//
+// Usage:
+//
+//	wkhtml-doctor [-format text|json] [-timeout 30s]
+//
+// It exits with status 1 if any check fails with an error.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+func main() {
+	format := flag.String("format", "text", "report format, text or json")
+	timeout := flag.Duration("timeout", 30*time.Second, "time allowed for all checks")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	d := wkhtmltox.Diagnose(ctx)
+
+	var err error
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	case "text":
+		err = d.WriteText(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "wkhtml-doctor: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wkhtml-doctor: %v\n", err)
+		os.Exit(2)
+	}
+
+	if !d.OK() {
+		os.Exit(1)
+	}
+}
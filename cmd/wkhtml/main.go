@@ -0,0 +1,268 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Command wkhtml converts HTML to PDF or images using the same JSON options
+// that ImageOptions and PDFOptions accept.
+//
+// Usage:
+//
+//	wkhtml pdf [--options file.json] [--timeout 5m] [--verbose] <input> <output>
+//	wkhtml image [--options file.json] [--timeout 5m] [--verbose] <input> <output>
+//	wkhtml batch [--concurrency 4] [--timeout 5m] [--resume] <manifest.jsonl> <report.jsonl>
+//
+// The input may be a URL, a local file or "-" for standard input, and the
+// output a local file or "-" for standard output. The output is checked
+// before it is written, and an existing file is only replaced once the
+// conversion has succeeded.
+//
+// A batch manifest has one {"kind", "input", "output", "options"} record per
+// line. A result is appended to the report for each record, and with --resume
+// the records that already succeeded in the report are skipped.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+const usage = `usage: wkhtml <command> [flags] <input> <output>
+
+commands:
+  pdf     convert to PDF with wkhtmltopdf, options decode into PDFOptions
+  image   convert to an image with wkhtmltoimage, options decode into ImageOptions
+  batch   convert every record of a JSON Lines manifest and write a report
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	if args[0] == "batch" {
+		return runBatch(args[1:], stdin, stderr)
+	}
+
+	kind := wkhtmltox.ConverterKind(args[0])
+	if _, err := kind.Binary(); err != nil {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("wkhtml "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	optionsFile := fs.String("options", "", "JSON file with conversion options")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time allowed for the conversion")
+	verbose := fs.Bool("verbose", false, "print the converter command and warnings")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(stderr, "wkhtml %s: expected <input> and <output>, got %d arguments\n", kind, fs.NArg())
+		return 2
+	}
+	input, output := fs.Arg(0), fs.Arg(1)
+
+	conv, err := loadConversion(kind, *optionsFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "wkhtml %s: %v\n", kind, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var src wkhtmltox.InputSource = wkhtmltox.URLSource{URL: input}
+	if input == "-" {
+		src = wkhtmltox.ReaderSource{Reader: stdin}
+	}
+
+	var sink wkhtmltox.OutputSink = wkhtmltox.FileSink{Path: output}
+	if output == "-" {
+		sink = wkhtmltox.WriterSink{Writer: stdout}
+	}
+
+	// The library pipeline checks the document, applies any rewriting the
+	// options ask for and only then delivers it
+	var ex wkhtmltox.Executor
+	if *verbose {
+		ex = verboseExecutor{w: stderr}
+	}
+	logs, err := conv.GenerateTo(ctx, ex, src, sink)
+
+	if *verbose {
+		for _, warning := range wkhtmltox.ParseWarnings(logs) {
+			fmt.Fprintf(stderr, "warning: %s\n", warning)
+		}
+	}
+
+	if err != nil {
+		stderr.Write(logs)
+		fmt.Fprintf(stderr, "wkhtml %s: %v\n", kind, err)
+		return 1
+	}
+
+	return 0
+}
+
+func runBatch(args []string, stdin io.Reader, stderr io.Writer) int {
+	fs := flag.NewFlagSet("wkhtml batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "conversions to run at once")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time allowed for each conversion")
+	resume := fs.Bool("resume", false, "skip records that already succeeded in the report")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(stderr, "wkhtml batch: expected <manifest> and <report>, got %d arguments\n", fs.NArg())
+		return 2
+	}
+
+	manifest := stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "wkhtml batch: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		manifest = f
+	}
+
+	opts := wkhtmltox.BatchOptions{Concurrency: *concurrency, Timeout: *timeout}
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if *resume {
+		previous, err := os.ReadFile(fs.Arg(1))
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(stderr, "wkhtml batch: %v\n", err)
+			return 1
+		}
+		opts.Resume = bytes.NewReader(previous)
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+		// Drop a line cut short when the previous run was interrupted, so
+		// that the first new result starts on a line of its own
+		if complete := bytes.LastIndexByte(previous, '\n') + 1; complete < len(previous) {
+			if err := os.Truncate(fs.Arg(1), int64(complete)); err != nil {
+				fmt.Fprintf(stderr, "wkhtml batch: %v\n", err)
+				return 1
+			}
+		}
+	}
+
+	report, err := os.OpenFile(fs.Arg(1), mode, 0644)
+	if err != nil {
+		fmt.Fprintf(stderr, "wkhtml batch: %v\n", err)
+		return 1
+	}
+	defer report.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	summary, err := wkhtmltox.RunBatch(ctx, manifest, report, opts)
+	fmt.Fprintf(stderr, "wkhtml batch: %d succeeded, %d failed, %d skipped\n", summary.Succeeded, summary.Failed, summary.Skipped)
+	if err != nil {
+		fmt.Fprintf(stderr, "wkhtml batch: %v\n", err)
+		return 1
+	}
+
+	if summary.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// verboseExecutor prints each command, with secrets masked, before running it
+// with wkhtmltox.DefaultExecutor. It prints what is run, such as the temporary
+// file a sink stages the output in, rather than the arguments wkhtml was given.
+type verboseExecutor struct {
+	w io.Writer
+}
+
+func (ve verboseExecutor) Execute(ctx context.Context, e wkhtmltox.Execution) (wkhtmltox.Output, error) {
+	fmt.Fprintln(ve.w, wkhtmltox.Command{Binary: e.Binary, Args: e.Args})
+
+	return wkhtmltox.DefaultExecutor.Execute(ctx, e)
+}
+
+// conversion is an ImageFlagSet or PDFFlagSet built from an options file
+type conversion interface {
+	GenerateTo(ctx context.Context, ex wkhtmltox.Executor, src wkhtmltox.InputSource, sink wkhtmltox.OutputSink) ([]byte, error)
+}
+
+func loadConversion(kind wkhtmltox.ConverterKind, optionsFile string) (conversion, error) {
+	var data []byte
+	if optionsFile != "" {
+		var err error
+		if data, err = os.ReadFile(optionsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if kind == wkhtmltox.ImageConverter {
+		var opts wkhtmltox.ImageOptions
+		if err := decodeOptions(data, &opts); err != nil {
+			return nil, err
+		}
+		ifs := wkhtmltox.NewImageFlagSetFromOptions(&opts)
+
+		return &ifs, nil
+	}
+
+	var opts wkhtmltox.PDFOptions
+	if err := decodeOptions(data, &opts); err != nil {
+		return nil, err
+	}
+	pfs := wkhtmltox.NewPDFFlagSetFromOptions(&opts)
+
+	return &pfs, nil
+}
+
+// decodeOptions rejects unknown fields, so that a typo in an options file is
+// not silently ignored
+func decodeOptions(data []byte, opts interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(opts); err != nil {
+		return fmt.Errorf("decoding options: %v", err)
+	}
+
+	return nil
+}
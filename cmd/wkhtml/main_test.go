@@ -0,0 +1,205 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestRunPDF(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	options := filepath.Join(dir, "options.json")
+	output := filepath.Join(dir, "file.pdf")
+	os.WriteFile(options, []byte(`{"title":"Report","password":"hunter2"}`), 0644)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"pdf", "--options", options, "--verbose", wkhtmltoxtest.WarningURL, output}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit status 0, got %d\n%s", code, stderr.String())
+	}
+
+	// The converter writes to a file staged beside the output
+	logs := stderr.String()
+	if !strings.Contains(logs, "wkhtmltopdf --password '********' --title Report "+wkhtmltoxtest.WarningURL+" "+filepath.Join(dir, ".file.pdf-")) {
+		t.Fatalf("expected the masked command that ran to be printed, got '%s'", logs)
+	}
+
+	if !strings.Contains(logs, "warning: Failed to load "+wkhtmltoxtest.WarningURL+"missing.png (ignore)") {
+		t.Fatalf("expected the warning to be printed, got '%s'", logs)
+	}
+
+	if data, _ := os.ReadFile(output); !bytes.Contains(data, []byte("/Title (Report)")) {
+		t.Fatalf("expected a PDF titled 'Report', got %q", data)
+	}
+}
+
+func TestRunPDFRewrite(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	options := filepath.Join(dir, "options.json")
+	os.WriteFile(options, []byte(`{"reproducible":true,"metadata":{"author":"Finance"}}`), 0644)
+
+	var outputs [2][]byte
+	for i := range outputs {
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"pdf", "--options", options, "http://example.com", "-"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("expected exit status 0, got %d\n%s", code, stderr.String())
+		}
+		outputs[i] = stdout.Bytes()
+	}
+
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Fatal("expected reproducible PDFs to be identical")
+	}
+
+	info, err := wkhtmltox.ReadPDFInfo(outputs[0])
+	if err != nil || info.Author != "Finance" || !info.CreationDate.IsZero() {
+		t.Fatalf("unexpected info %+v (%v)", info, err)
+	}
+}
+
+func TestRunKeepsOutputOnFailure(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	output := filepath.Join(t.TempDir(), "file.pdf")
+	os.WriteFile(output, []byte("previous"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"pdf", wkhtmltoxtest.CrashURL, output}, nil, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit status 1, got %d", code)
+	}
+
+	if data, _ := os.ReadFile(output); string(data) != "previous" {
+		t.Fatalf("expected the previous output to be kept, got %q", data)
+	}
+}
+
+func TestRunImageStandardStreams(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"image", "-", "-"}, strings.NewReader("<p>hello</p>"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit status 0, got %d\n%s", code, stderr.String())
+	}
+
+	if !bytes.HasPrefix(stdout.Bytes(), []byte("\x89PNG")) {
+		t.Fatalf("expected a PNG on standard output, got %q", stdout.Bytes())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	options := filepath.Join(dir, "options.json")
+	os.WriteFile(options, []byte(`{"titel":"Report"}`), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"pdf", "--options", options, "in.html", "out.pdf"}, nil, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "titel") {
+		t.Fatalf("expected unknown options to be rejected, got %d\n%s", code, stderr.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"pdf", wkhtmltoxtest.NetworkErrorURL, filepath.Join(dir, "out.pdf")}, nil, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "HostNotFoundError") {
+		t.Fatalf("expected the converter failure to be reported, got %d\n%s", code, stderr.String())
+	}
+
+	if code := run([]string{"gif", "in", "out"}, nil, &stdout, &stderr); code != 2 {
+		t.Fatalf("expected an unknown command to fail with status 2, got %d", code)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.jsonl")
+	report := filepath.Join(dir, "report.jsonl")
+	records := fmt.Sprintf(`{"kind":"pdf","input":"http://example.com","output":%q,"options":{"title":"One"}}
+{"kind":"image","input":%q,"output":%q}
+`, filepath.Join(dir, "1.pdf"), wkhtmltoxtest.NetworkErrorURL, filepath.Join(dir, "2.png"))
+	os.WriteFile(manifest, []byte(records), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"batch", manifest, report}, nil, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit status 1 for the failed record, got %d\n%s", code, stderr.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"batch", "--resume", manifest, report}, nil, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit status 1 for the failed record, got %d\n%s", code, stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "0 succeeded, 1 failed, 1 skipped") {
+		t.Fatalf("expected the successful record to be skipped, got '%s'", stderr.String())
+	}
+
+	data, _ := os.ReadFile(report)
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("expected 3 report lines, got %d:\n%s", lines, data)
+	}
+}
+
+func TestRunBatchResumeTruncatedReport(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.jsonl")
+	report := filepath.Join(dir, "report.jsonl")
+	records := fmt.Sprintf(`{"kind":"pdf","input":"http://example.com","output":%q}
+{"kind":"pdf","input":"http://example.com","output":%q}
+`, filepath.Join(dir, "1.pdf"), filepath.Join(dir, "2.pdf"))
+	os.WriteFile(manifest, []byte(records), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"batch", manifest, report}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit status 0, got %d\n%s", code, stderr.String())
+	}
+
+	// Cut the report off in the middle of its last result, as a crash would
+	data, _ := os.ReadFile(report)
+	os.WriteFile(report, data[:len(data)-10], 0644)
+
+	stderr.Reset()
+	if code := run([]string{"batch", "--resume", manifest, report}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit status 0, got %d\n%s", code, stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "1 succeeded, 0 failed, 1 skipped") {
+		t.Fatalf("expected the cut off record to run again, got '%s'", stderr.String())
+	}
+
+	data, _ = os.ReadFile(report)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("expected every report line to be JSON, got:\n%s", data)
+		}
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 report lines, got %d:\n%s", len(lines), data)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Command wkhtmld serves the wkhtmltox converters over HTTP.
+//
+// Usage:
+//
+//	wkhtmld [-addr :8080] [-max-request-bytes 10485760] [-timeout 1m] [-concurrency 4]
+//	        [-job-timeout 10m] [-result-ttl 1h] [-result-dir DIR] [-public-url URL]
+//
+// Job results are kept in memory unless -result-dir is given. Webhooks are
+// signed with the key in the WKHTMLD_WEBHOOK_SECRET environment variable.
+//
+// On SIGINT or SIGTERM, wkhtmld stops accepting requests and waits up to
+// -timeout for the conversions and jobs in progress, then cancels the rest.
+//
+// See the server package for the endpoints.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	maxRequestBytes := flag.Int64("max-request-bytes", server.DefaultMaxRequestBytes, "largest request body accepted")
+	timeout := flag.Duration("timeout", server.DefaultTimeout, "time allowed for each conversion")
+	concurrency := flag.Int("concurrency", runtime.NumCPU(), "conversions to run at once before answering 503")
+	jobTimeout := flag.Duration("job-timeout", server.DefaultJobTimeout, "time allowed for each asynchronous job")
+	resultTTL := flag.Duration("result-ttl", server.DefaultResultTTL, "how long job results are kept")
+	resultDir := flag.String("result-dir", "", "directory to keep job results in, instead of memory")
+	publicURL := flag.String("public-url", "", "base URL of the server, used for result links in webhooks")
+	flag.Parse()
+
+	cfg := server.Config{
+		MaxRequestBytes: *maxRequestBytes,
+		Timeout:         *timeout,
+		MaxConcurrent:   *concurrency,
+		JobTimeout:      *jobTimeout,
+		ResultTTL:       *resultTTL,
+		PublicURL:       *publicURL,
+		WebhookSecret:   []byte(os.Getenv("WKHTMLD_WEBHOOK_SECRET")),
+	}
+	if *resultDir != "" {
+		store, err := server.NewFileStore(*resultDir)
+		if err != nil {
+			log.Fatalf("wkhtmld: %v", err)
+		}
+		cfg.Store = store
+	}
+	handler := server.New(cfg)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+
+		// Let conversions and jobs in progress finish, then cancel the rest
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("wkhtmld: stopping the listener: %v", err)
+		}
+		if err := handler.Shutdown(shutdownCtx); err != nil {
+			log.Printf("wkhtmld: canceled jobs still running: %v", err)
+		}
+	}()
+
+	log.Printf("wkhtmld: listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("wkhtmld: %v", err)
+	}
+
+	// ListenAndServe returns as soon as Shutdown starts
+	<-shutdown
+}
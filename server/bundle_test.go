@@ -0,0 +1,204 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/server"
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+// assetExecutor records whether the stylesheet beside the input existed
+// while the converter ran
+type assetExecutor struct {
+	*wkhtmltoxtest.Executor
+	found []string
+}
+
+func (ae *assetExecutor) Execute(ctx context.Context, e wkhtmltox.Execution) (wkhtmltox.Output, error) {
+	input := e.Args[len(e.Args)-2]
+	if css, err := os.ReadFile(filepath.Join(filepath.Dir(input), "css", "site.css")); err == nil {
+		ae.found = append(ae.found, string(css))
+	}
+
+	return ae.Executor.Execute(ctx, e)
+}
+
+func multipartBody(t *testing.T, fields map[string]string, files map[string]string) (string, *bytes.Buffer) {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	for name, data := range files {
+		w, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		w.Write([]byte(data))
+	}
+	mw.Close()
+
+	return mw.FormDataContentType(), &body
+}
+
+func TestRenderMultipartFiles(t *testing.T) {
+	ex := &assetExecutor{Executor: wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})}
+	tmp := t.TempDir()
+	h := server.New(server.Config{Executor: ex, TempDir: tmp})
+
+	contentType, body := multipartBody(t,
+		map[string]string{"options": `{"title":"Styled"}`},
+		map[string]string{"index.html": `<link href="css/site.css">`, "css/site.css": "body {}"},
+	)
+	r := httptest.NewRequest(http.MethodPost, "/pdf", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Body.String() != string(wkhtmltoxtest.PDF(1)) {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if len(ex.found) != 1 || ex.found[0] != "body {}" {
+		t.Fatalf("expected the stylesheet to resolve beside the entry, got %q", ex.found)
+	}
+
+	args := ex.Calls()[0].Args
+	input := args[len(args)-2]
+	if filepath.Base(input) != "index.html" || args[len(args)-4] != "--title" {
+		t.Fatalf("unexpected arguments '%s'", args)
+	}
+
+	if args[0] != "--allow" || args[1] != filepath.Dir(input) || args[2] != "--disable-local-file-access" {
+		t.Fatalf("expected local files to be restricted to %s, got '%s'", filepath.Dir(input), args)
+	}
+
+	if left, _ := os.ReadDir(tmp); len(left) != 0 {
+		t.Fatalf("expected the bundle to be removed, found %d entries", len(left))
+	}
+}
+
+func TestRenderZipBundle(t *testing.T) {
+	ex := &assetExecutor{Executor: wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(8, 8)})}
+	h := server.New(server.Config{Executor: ex})
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, data := range map[string]string{"report/main.html": "<p>hi</p>", "report/css/site.css": "p {}"} {
+		f, _ := zw.Create(name)
+		f.Write([]byte(data))
+	}
+	zw.Close()
+
+	w := post(t, h, "/image", `{"bundle":"`+base64.StdEncoding.EncodeToString(archive.Bytes())+`","entry":"report/main.html"}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if len(ex.found) != 1 || ex.found[0] != "p {}" {
+		t.Fatalf("expected the stylesheet to resolve beside the entry, got %q", ex.found)
+	}
+}
+
+func TestRenderBundleBlocksLocalFiles(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	h := server.New(server.Config{})
+
+	contentType, body := multipartBody(t, nil, map[string]string{
+		"index.html":   `<link href="css/site.css"><iframe src="file:///etc/passwd"></iframe>`,
+		"css/site.css": "body {}",
+	})
+	r := httptest.NewRequest(http.MethodPost, "/pdf", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "Blocked access to file /etc/passwd") {
+		t.Fatalf("expected status 502, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRenderBundleRejected(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor()
+	h := server.New(server.Config{Executor: ex, BundleLimits: wkhtmltox.BundleLimits{MaxFiles: 1}})
+
+	for _, files := range []map[string]string{
+		{"../../etc/cron.d/evil": "x"},
+		{"index.html": "<p>hi</p>", "extra.css": "x"},
+		{"main.html": "<p>no index</p>"},
+	} {
+		contentType, body := multipartBody(t, nil, files)
+		r := httptest.NewRequest(http.MethodPost, "/pdf", body)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for %v, got %d: %s", files, w.Code, w.Body)
+		}
+	}
+
+	w := post(t, h, "/pdf", `{"url":"https://example.com","bundle":"UEsFBgAAAAAAAAAAAAAAAAAAAAAAAA=="}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for two sources, got %d: %s", w.Code, w.Body)
+	}
+
+	if n := len(ex.Calls()); n != 0 {
+		t.Fatalf("expected no conversions, got %d", n)
+	}
+}
+
+func TestJobMultipartIdempotency(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	h := server.New(server.Config{Executor: ex})
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		// Each body has a new random boundary
+		contentType, body := multipartBody(t, map[string]string{"kind": "pdf"}, map[string]string{"index.html": "<p>hi</p>"})
+		r := httptest.NewRequest(http.MethodPost, "/jobs", body)
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("Idempotency-Key", "bundle-1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusAccepted && w.Code != http.StatusOK {
+			t.Fatalf("expected the job to be accepted, got %d: %s", w.Code, w.Body)
+		}
+		ids = append(ids, statusOf(t, w).ID)
+	}
+
+	if ids[0] != ids[1] {
+		t.Fatalf("expected the same job, got %q", ids)
+	}
+}
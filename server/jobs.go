@@ -0,0 +1,455 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/api"
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+// JobState is the lifecycle stage of an asynchronous job
+type JobState = api.JobState
+
+// States an asynchronous job moves through
+const (
+	JobQueued    = api.JobQueued
+	JobRunning   = api.JobRunning
+	JobSucceeded = api.JobSucceeded
+	JobFailed    = api.JobFailed
+	JobCanceled  = api.JobCanceled
+)
+
+// JobRequest is the body of POST /jobs
+type JobRequest = api.JobRequest
+
+// JobStatus is the body of POST /jobs and GET /jobs/{id}
+type JobStatus = api.JobStatus
+
+// asyncJob is the server's record of a job submitted to POST /jobs
+type asyncJob struct {
+	status         JobStatus
+	cancel         context.CancelFunc
+	progress       *progressWriter
+	callbackURL    string
+	idempotencyKey string
+	requestHash    string
+}
+
+// progressPattern matches the percentages of the converters' progress bars
+var progressPattern = regexp.MustCompile(`(\d{1,3})%`)
+
+// progressWriter tracks the latest percentage a converter printed
+type progressWriter struct {
+	mu      sync.Mutex
+	line    []byte
+	percent int
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	// Progress bars are redrawn using carriage returns, so only the
+	// unfinished line is kept between writes
+	pw.line = append(pw.line, p...)
+	for _, m := range progressPattern.FindAllSubmatch(pw.line, -1) {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n <= 100 {
+			pw.percent = n
+		}
+	}
+	for i := len(pw.line) - 1; i >= 0; i-- {
+		if pw.line[i] == '\r' || pw.line[i] == '\n' {
+			pw.line = append([]byte(nil), pw.line[i+1:]...)
+			break
+		}
+	}
+
+	return len(p), nil
+}
+
+func (pw *progressWriter) Percent() int {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	return pw.percent
+}
+
+// progressExecutor streams standard error of every execution to a writer
+type progressExecutor struct {
+	ex wkhtmltox.Executor
+	w  io.Writer
+}
+
+func (pe progressExecutor) Execute(ctx context.Context, e wkhtmltox.Execution) (wkhtmltox.Output, error) {
+	if e.Stderr == nil {
+		e.Stderr = pe.w
+	}
+
+	ex := pe.ex
+	if ex == nil {
+		ex = wkhtmltox.DefaultExecutor
+	}
+
+	return ex.Execute(ctx, e)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// snapshot returns the current status of a job. The caller must hold jobsMu.
+func (j *asyncJob) snapshot() JobStatus {
+	status := j.status
+	if status.State == JobRunning {
+		status.Progress = j.progress.Percent()
+	}
+	status.Warnings = append([]string(nil), status.Warnings...)
+	status.Deliveries = append([]DeliveryAttempt(nil), status.Deliveries...)
+
+	return status
+}
+
+// sweepJobs forgets jobs that have expired. The caller must hold jobsMu.
+func (s *Server) sweepJobs() {
+	now := time.Now()
+	for id, j := range s.jobs {
+		if j.status.ExpiresAt != nil && !now.Before(*j.status.ExpiresAt) {
+			s.forgetJob(id, j)
+		}
+	}
+}
+
+// forgetJob removes a job and its idempotency key. The caller must hold
+// jobsMu.
+func (s *Server) forgetJob(id string, j *asyncJob) {
+	delete(s.jobs, id)
+	if j.idempotencyKey != "" && s.idempotency[j.idempotencyKey] == id {
+		delete(s.idempotency, j.idempotencyKey)
+	}
+}
+
+// lookupJob returns the current status of a job, or a 404 error
+func (s *Server) lookupJob(id string) (JobStatus, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	s.sweepJobs()
+	j, ok := s.jobs[id]
+	if !ok {
+		return JobStatus{}, &statusError{status: http.StatusNotFound, err: fmt.Errorf("job %q not found", id)}
+	}
+
+	return j.snapshot(), nil
+}
+
+func writeJobStatus(w http.ResponseWriter, code int, status JobStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	req, err := s.decodeRequest(w, r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	// The bundle is handed to stage once the request is accepted
+	closeBundle := func() {
+		if req.bundle != nil {
+			req.bundle.Close()
+		}
+	}
+
+	if _, err := req.Kind.Binary(); err != nil {
+		closeBundle()
+		s.writeError(w, badRequest("%v", err))
+		return
+	}
+
+	if req.CallbackURL != "" {
+		if err := checkCallbackURL(req.CallbackURL); err != nil {
+			closeBundle()
+			s.writeError(w, err)
+			return
+		}
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	hash := req.hash
+
+	s.jobsMu.Lock()
+	s.sweepJobs()
+	if id, ok := s.idempotency[key]; ok && key != "" {
+		j := s.jobs[id]
+		status := j.snapshot()
+		sameRequest := j.requestHash == hash
+		s.jobsMu.Unlock()
+		closeBundle()
+
+		s.writeIdempotentJob(w, id, status, sameRequest)
+		return
+	}
+
+	active := 0
+	for _, j := range s.jobs {
+		if !j.status.State.Finished() {
+			active++
+		}
+	}
+	s.jobsMu.Unlock()
+
+	if active >= s.cfg.MaxQueuedJobs {
+		closeBundle()
+		w.Header().Set("Retry-After", "1")
+		s.writeError(w, &statusError{status: http.StatusServiceUnavailable, err: errors.New("too many jobs queued")})
+		return
+	}
+
+	sr, err := s.stage(req.Kind, req.RenderRequest, req.bundle)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		sr.cleanup()
+		s.writeError(w, err)
+		return
+	}
+
+	// Canceled when the job is deleted or the server shuts down; runJob
+	// limits the conversion itself to JobTimeout
+	ctx, cancel := context.WithCancel(s.ctx)
+	j := &asyncJob{
+		status: JobStatus{
+			ID:        id,
+			Kind:      req.Kind,
+			State:     JobQueued,
+			CreatedAt: time.Now().UTC(),
+		},
+		cancel:         cancel,
+		progress:       &progressWriter{},
+		callbackURL:    req.CallbackURL,
+		idempotencyKey: key,
+		requestHash:    hash,
+	}
+
+	s.jobsMu.Lock()
+	if s.closed {
+		s.jobsMu.Unlock()
+		cancel()
+		sr.cleanup()
+
+		s.writeError(w, &statusError{status: http.StatusServiceUnavailable, err: errors.New("server is shutting down")})
+		return
+	}
+	if other, ok := s.idempotency[key]; ok && key != "" {
+		// Another request with the same key won the race
+		status := s.jobs[other].snapshot()
+		sameRequest := s.jobs[other].requestHash == hash
+		s.jobsMu.Unlock()
+		cancel()
+		sr.cleanup()
+
+		s.writeIdempotentJob(w, other, status, sameRequest)
+		return
+	}
+	s.jobs[id] = j
+	if key != "" {
+		s.idempotency[key] = id
+	}
+	status := j.snapshot()
+	// Added under jobsMu, so that Shutdown never waits while a job is added
+	s.workers.Add(1)
+	s.jobsMu.Unlock()
+
+	go s.runJob(ctx, id, j, sr)
+
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJobStatus(w, http.StatusAccepted, status)
+}
+
+// writeIdempotentJob answers a request whose idempotency key was already used
+// for job id, unless the key was used for a different request
+func (s *Server) writeIdempotentJob(w http.ResponseWriter, id string, status JobStatus, sameRequest bool) {
+	if !sameRequest {
+		s.writeError(w, &statusError{status: http.StatusUnprocessableEntity, err: errors.New("idempotency key was used for a different request")})
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJobStatus(w, http.StatusOK, status)
+}
+
+// runJob waits for a free conversion slot, renders the job, stores its
+// result and calls its callback URL
+func (s *Server) runJob(ctx context.Context, id string, j *asyncJob, sr *stagedRender) {
+	defer s.workers.Done()
+	defer j.cancel()
+	defer sr.cleanup()
+
+	var result *wkhtmltox.Result
+	var err error
+
+	renderCtx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
+	select {
+	case s.slots <- struct{}{}:
+		s.setJobState(j, JobRunning)
+		result, err = s.render(renderCtx, progressExecutor{ex: s.cfg.Executor, w: j.progress}, sr)
+		<-s.slots
+	case <-renderCtx.Done():
+		err = renderCtx.Err()
+	}
+	cancel()
+
+	if err == nil {
+		err = s.cfg.Store.Put(context.Background(), id, *result, s.cfg.ResultTTL)
+	}
+
+	s.jobsMu.Lock()
+	if s.jobs[id] != j {
+		// The job was deleted while it ran
+		s.jobsMu.Unlock()
+		if err == nil {
+			s.cfg.Store.Delete(context.Background(), id)
+		}
+		return
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(s.cfg.ResultTTL)
+	j.status.FinishedAt = &now
+	j.status.ExpiresAt = &expires
+
+	switch {
+	case err == nil:
+		j.status.State = JobSucceeded
+		j.status.Progress = 100
+		j.status.Warnings = result.Warnings
+	case errors.Is(err, context.Canceled):
+		j.status.State = JobCanceled
+	default:
+		s.cfg.Logger.Printf("server: job %s: %v", id, err)
+		_, failure := newErrorResponse(err)
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+		j.status.Failure = &failure
+	}
+
+	payload := WebhookPayload{
+		JobID:    id,
+		State:    j.status.State,
+		Error:    j.status.Error,
+		Warnings: j.status.Warnings,
+	}
+	if payload.State == JobSucceeded {
+		payload.ResultURL = s.resultURL(id)
+	}
+	s.jobsMu.Unlock()
+
+	if j.callbackURL != "" {
+		s.deliverWebhook(ctx, j.callbackURL, j, payload)
+	}
+}
+
+func (s *Server) setJobState(j *asyncJob, state JobState) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	j.status.State = state
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	status, err := s.lookupJob(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	writeJobStatus(w, http.StatusOK, status)
+}
+
+func (s *Server) handleGetJobResult(w http.ResponseWriter, r *http.Request) {
+	status, err := s.lookupJob(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if status.State != JobSucceeded {
+		s.writeError(w, &statusError{status: http.StatusConflict, err: fmt.Errorf("job is %s", status.State)})
+		return
+	}
+
+	result, err := s.cfg.Store.Get(r.Context(), status.ID)
+	if errors.Is(err, ErrNotFound) {
+		err = &statusError{status: http.StatusNotFound, err: errors.New("result has expired")}
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	writeResult(w, &result)
+}
+
+func (s *Server) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	s.jobsMu.Lock()
+	s.sweepJobs()
+	j, ok := s.jobs[id]
+	if ok {
+		s.forgetJob(id, j)
+	}
+	s.jobsMu.Unlock()
+
+	if !ok {
+		s.writeError(w, &statusError{status: http.StatusNotFound, err: fmt.Errorf("job %q not found", id)})
+		return
+	}
+
+	j.cancel()
+	if err := s.cfg.Store.Delete(r.Context(), id); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,420 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/server"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func submitJob(t *testing.T, h http.Handler, key string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func request(h http.Handler, method string, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+	return w
+}
+
+func statusOf(t *testing.T, w *httptest.ResponseRecorder) server.JobStatus {
+	t.Helper()
+
+	var status server.JobStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("expected a job status, got %q", w.Body.String())
+	}
+
+	return status
+}
+
+// waitForJob polls a job until done reports true for its status
+func waitForJob(t *testing.T, h http.Handler, id string, done func(server.JobStatus) bool) server.JobStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := request(h, http.MethodGet, "/jobs/"+id)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		status := statusOf(t, w)
+		if done(status) {
+			return status
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for job, last status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{
+		Stderr:     []byte("Loading pages (1/6)\n[==============>             ] 50%\r"),
+		Delay:      200 * time.Millisecond,
+		OutputFile: wkhtmltoxtest.PDF(1),
+	})
+	h := server.New(server.Config{Executor: ex})
+
+	w := submitJob(t, h, "", `{"kind":"pdf","html":"<p>hello</p>"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body)
+	}
+
+	status := statusOf(t, w)
+	if status.ID == "" || status.Kind != "pdf" || w.Header().Get("Location") != "/jobs/"+status.ID {
+		t.Fatalf("unexpected status %+v with location %q", status, w.Header().Get("Location"))
+	}
+
+	running := waitForJob(t, h, status.ID, func(s server.JobStatus) bool {
+		return s.State == server.JobRunning && s.Progress == 50
+	})
+	if running.FinishedAt != nil {
+		t.Fatalf("expected a running job to be unfinished, got %+v", running)
+	}
+
+	done := waitForJob(t, h, status.ID, func(s server.JobStatus) bool { return s.State.Finished() })
+	if done.State != server.JobSucceeded || done.Progress != 100 || done.ExpiresAt == nil {
+		t.Fatalf("unexpected status %+v", done)
+	}
+
+	w = request(h, http.MethodGet, "/jobs/"+status.ID+"/result")
+	if w.Code != http.StatusOK || w.Body.String() != string(wkhtmltoxtest.PDF(1)) || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("unexpected result %d %s: %q", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+}
+
+func TestJobResultNotReady(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Delay: 10 * time.Second})
+	h := server.New(server.Config{Executor: ex})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"image","url":"https://example.com"}`)).ID
+	defer request(h, http.MethodDelete, "/jobs/"+id)
+
+	w := request(h, http.MethodGet, "/jobs/"+id+"/result")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestJobFailure(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{
+		Stderr:   []byte("Error: Failed loading page"),
+		ExitCode: 1,
+	})
+	h := server.New(server.Config{Executor: ex, Logger: log.New(io.Discard, "", 0)})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com"}`)).ID
+	done := waitForJob(t, h, id, func(s server.JobStatus) bool { return s.State.Finished() })
+
+	if done.State != server.JobFailed || !strings.Contains(done.Error, "Failed loading page") {
+		t.Fatalf("unexpected status %+v", done)
+	}
+
+	w := request(h, http.MethodGet, "/jobs/"+id+"/result")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Delay: 10 * time.Second})
+	h := server.New(server.Config{Executor: ex})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com"}`)).ID
+	waitForJob(t, h, id, func(s server.JobStatus) bool { return s.State == server.JobRunning })
+
+	w := request(h, http.MethodDelete, "/jobs/"+id)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", w.Code, w.Body)
+	}
+
+	w = request(h, http.MethodGet, "/jobs/"+id)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body)
+	}
+
+	w = request(h, http.MethodDelete, "/jobs/"+id)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestShutdownDrainsJobs(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Delay: 200 * time.Millisecond, OutputFile: wkhtmltoxtest.PDF(1)})
+	h := server.New(server.Config{Executor: ex})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com"}`)).ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if status := statusOf(t, request(h, http.MethodGet, "/jobs/"+id)); status.State != server.JobSucceeded {
+		t.Fatalf("expected the job to finish, got %+v", status)
+	}
+
+	if w := submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com"}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 after shutdown, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestShutdownCancelsJobs(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Delay: 10 * time.Second})
+	h := server.New(server.Config{Executor: ex})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com"}`)).ID
+	waitForJob(t, h, id, func(s server.JobStatus) bool { return s.State == server.JobRunning })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+
+	if status := statusOf(t, request(h, http.MethodGet, "/jobs/"+id)); status.State != server.JobCanceled {
+		t.Fatalf("expected the job to be canceled, got %+v", status)
+	}
+}
+
+func TestJobIdempotencyKey(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	h := server.New(server.Config{Executor: ex})
+	body := `{"kind":"pdf","url":"https://example.com"}`
+
+	first := submitJob(t, h, "report-42", body)
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", first.Code, first.Body)
+	}
+	id := statusOf(t, first).ID
+
+	again := submitJob(t, h, "report-42", body)
+	if again.Code != http.StatusOK || statusOf(t, again).ID != id {
+		t.Fatalf("expected the first job to be returned, got %d: %s", again.Code, again.Body)
+	}
+
+	other := submitJob(t, h, "report-42", `{"kind":"pdf","url":"https://example.org"}`)
+	if other.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d: %s", other.Code, other.Body)
+	}
+
+	waitForJob(t, h, id, func(s server.JobStatus) bool { return s.State.Finished() })
+	if n := len(ex.Calls()); n != 1 {
+		t.Fatalf("expected the converter to run once, got %d", n)
+	}
+}
+
+func TestJobIdempotencyKeyRace(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	h := server.New(server.Config{Executor: ex})
+
+	// Requests that arrive together may all pass the first check for the
+	// key, and staging a large document keeps them apart long enough
+	page := strings.Repeat("<p>page</p>", 1<<16)
+	codes := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = submitJob(t, h, "report-42", fmt.Sprintf(`{"kind":"pdf","html":"%s%d"}`, page, i)).Code
+		}()
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusAccepted:
+			accepted++
+		case http.StatusUnprocessableEntity:
+		default:
+			t.Fatalf("expected status 202 or 422, got %v", codes)
+		}
+	}
+
+	if accepted != 1 {
+		t.Fatalf("expected one request to be accepted, got %v", codes)
+	}
+}
+
+func TestJobInvalidRequest(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor()
+	h := server.New(server.Config{Executor: ex})
+
+	for _, body := range []string{
+		`{"kind":"doc","url":"https://example.com"}`,
+		`{"kind":"pdf","url":"ftp://example.com"}`,
+		`{"kind":"pdf"}`,
+		`{"kind":"image","url":"https://example.com","options":{"format":"gif"}}`,
+	} {
+		w := submitJob(t, h, "", body)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for %s, got %d: %s", body, w.Code, w.Body)
+		}
+	}
+
+	if n := len(ex.Calls()); n != 0 {
+		t.Fatalf("expected no conversions, got %d", n)
+	}
+}
+
+func TestJobExpiry(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	h := server.New(server.Config{Executor: ex, ResultTTL: 100 * time.Millisecond})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com"}`)).ID
+	waitForJob(t, h, id, func(s server.JobStatus) bool { return s.State.Finished() })
+
+	time.Sleep(150 * time.Millisecond)
+
+	w := request(h, http.MethodGet, "/jobs/"+id)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestJobWebhook(t *testing.T) {
+	secret := []byte("s3cret")
+	deliveries := make(chan server.WebhookPayload, 1)
+	attempts := 0
+
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !server.VerifySignature(secret, body, r.Header.Get(server.SignatureHeader)) {
+			t.Errorf("unexpected signature %q", r.Header.Get(server.SignatureHeader))
+		}
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var payload server.WebhookPayload
+		json.Unmarshal(body, &payload)
+		deliveries <- payload
+	}))
+	defer callback.Close()
+
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{
+		OutputFile: wkhtmltoxtest.PDF(1),
+		Stderr:     []byte("Warning: slow\n"),
+	})
+	h := server.New(server.Config{
+		Executor:       ex,
+		Logger:         log.New(io.Discard, "", 0),
+		PublicURL:      "https://render.example.com/",
+		WebhookSecret:  secret,
+		WebhookBackoff: 10 * time.Millisecond,
+	})
+
+	id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com","callback_url":"`+callback.URL+`"}`)).ID
+
+	select {
+	case payload := <-deliveries:
+		if payload.JobID != id || payload.State != server.JobSucceeded || payload.ResultURL != "https://render.example.com/jobs/"+id+"/result" || len(payload.Warnings) != 1 {
+			t.Fatalf("unexpected payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+	}
+
+	status := waitForJob(t, h, id, func(s server.JobStatus) bool { return len(s.Deliveries) == 2 })
+	if status.Deliveries[0].StatusCode != http.StatusInternalServerError || status.Deliveries[0].Error == "" {
+		t.Fatalf("expected the first attempt to fail, got %+v", status.Deliveries[0])
+	}
+	if status.Deliveries[1].StatusCode != http.StatusOK || status.Deliveries[1].Error != "" {
+		t.Fatalf("expected the second attempt to succeed, got %+v", status.Deliveries[1])
+	}
+}
+
+func TestJobWebhookRetriesStop(t *testing.T) {
+	attempts := make(chan struct{}, 10)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer callback.Close()
+
+	for _, stop := range []string{"delete", "shutdown"} {
+		h := server.New(server.Config{
+			Executor:       wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)}),
+			Logger:         log.New(io.Discard, "", 0),
+			WebhookBackoff: time.Hour,
+		})
+
+		id := statusOf(t, submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com","callback_url":"`+callback.URL+`"}`)).ID
+		<-attempts
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if stop == "delete" {
+			request(h, http.MethodDelete, "/jobs/"+id)
+		} else {
+			// A done context makes Shutdown cancel the jobs straight away
+			cancel()
+		}
+
+		// Shutdown returns once the job's goroutine, retries included, is done
+		done := make(chan error, 1)
+		go func() { done <- h.Shutdown(ctx) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %s to stop the webhook retries", stop)
+		}
+		cancel()
+	}
+}
+
+func TestJobWebhookRejectsScheme(t *testing.T) {
+	h := server.New(server.Config{Executor: wkhtmltoxtest.NewExecutor()})
+
+	w := submitJob(t, h, "", `{"kind":"pdf","url":"https://example.com","callback_url":"file:///etc/passwd"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body)
+	}
+}
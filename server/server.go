@@ -0,0 +1,619 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Package server exposes the wkhtmltox converters over HTTP.
+//
+// POST /pdf and POST /image take a RenderRequest and respond with the
+// rendered document. GET /healthz reports that the server is up and
+// GET /readyz that both converters are installed.
+//
+// Slow conversions can be run asynchronously: POST /jobs takes a JobRequest
+// and responds with a JobStatus whose ID can be polled with GET /jobs/{id}.
+// Once the job has succeeded, GET /jobs/{id}/result returns the document,
+// which is kept in a ResultStore until it expires. DELETE /jobs/{id} cancels
+// a job and discards its result. A request sent with an Idempotency-Key
+// header that matches an earlier one returns the earlier job instead of
+// starting another. A job with a callback URL is sent a signed
+// WebhookPayload when it finishes.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/api"
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+// Defaults for zero Config fields
+const (
+	DefaultMaxRequestBytes = 10 << 20
+	DefaultTimeout         = time.Minute
+	DefaultJobTimeout      = 10 * time.Minute
+	DefaultResultTTL       = time.Hour
+	DefaultMaxQueuedJobs   = 100
+)
+
+// Config configures a Server
+type Config struct {
+	MaxRequestBytes int64                  // Largest request body accepted, DefaultMaxRequestBytes if zero
+	Timeout         time.Duration          // Time allowed for each conversion, DefaultTimeout if zero
+	MaxConcurrent   int                    // Conversions run at once before answering 503, runtime.NumCPU() if zero
+	Executor        wkhtmltox.Executor     // How to run converters, nil for wkhtmltox.DefaultExecutor
+	TempDir         string                 // Where inputs and outputs are staged, os.TempDir() if empty
+	Logger          *log.Logger            // Where errors are logged, nil for the standard logger
+	JobTimeout      time.Duration          // Time allowed for each asynchronous job, DefaultJobTimeout if zero
+	MaxQueuedJobs   int                    // Unfinished jobs allowed before answering 503, DefaultMaxQueuedJobs if zero
+	Store           ResultStore            // Where job results are kept, a new MemoryStore if nil
+	ResultTTL       time.Duration          // How long finished jobs are kept, DefaultResultTTL if zero
+	PublicURL       string                 // Base URL of the server, used for result links in webhooks
+	WebhookSecret   []byte                 // Key used to sign webhooks, which are unsigned if empty
+	WebhookClient   *http.Client           // Client that delivers webhooks, nil for one with a 10 second timeout
+	WebhookRetries  int                    // Retries after a failed delivery, DefaultWebhookRetries if zero
+	WebhookBackoff  time.Duration          // Wait before the first retry, doubled each time, DefaultWebhookBackoff if zero
+	BundleLimits    wkhtmltox.BundleLimits // Limits on uploaded bundles
+}
+
+// RenderRequest is the body of POST /pdf and POST /image
+type RenderRequest = api.RenderRequest
+
+// Types of error reported in an ErrorResponse
+const (
+	ErrorTypeUnsafeArgument = api.ErrorTypeUnsafeArgument
+	ErrorTypeExit           = api.ErrorTypeExit
+	ErrorTypeTimeout        = api.ErrorTypeTimeout
+	ErrorTypeBundle         = api.ErrorTypeBundle
+	ErrorTypeOutput         = api.ErrorTypeOutput
+)
+
+// ErrorResponse is the body of every unsuccessful response
+type ErrorResponse = api.ErrorResponse
+
+// newErrorResponse describes err, returning the HTTP status it should be
+// answered with
+func newErrorResponse(err error) (int, ErrorResponse) {
+	status := http.StatusInternalServerError
+	resp := ErrorResponse{Error: err.Error()}
+
+	var se *statusError
+	var unsafeErr *wkhtmltox.UnsafeArgumentError
+	var exitErr *wkhtmltox.ExitError
+	var bundleErr *wkhtmltox.BundleError
+	var outputErr *wkhtmltox.OutputError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &se):
+		status = se.status
+	case errors.As(err, &tooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.As(err, &unsafeErr):
+		status = http.StatusBadRequest
+		resp.Type = ErrorTypeUnsafeArgument
+		resp.Name, resp.Value, resp.Reason = unsafeErr.Name, unsafeErr.Value, unsafeErr.Reason
+	case errors.As(err, &bundleErr):
+		status = http.StatusBadRequest
+		resp.Type = ErrorTypeBundle
+		resp.Name, resp.Reason = bundleErr.Name, bundleErr.Reason
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+		resp.Type = ErrorTypeTimeout
+	case errors.As(err, &exitErr):
+		status = http.StatusBadGateway
+		resp.Type = ErrorTypeExit
+		resp.Binary, resp.ExitCode = exitErr.Binary, exitErr.Code
+	case errors.As(err, &outputErr):
+		status = http.StatusBadGateway
+		resp.Type = ErrorTypeOutput
+		resp.Name, resp.Reason = string(outputErr.Problem), outputErr.Reason
+	}
+
+	return status, resp
+}
+
+// Server renders documents over HTTP
+type Server struct {
+	cfg   Config
+	slots chan struct{}
+	mux   *http.ServeMux
+
+	jobsMu      sync.Mutex
+	jobs        map[string]*asyncJob
+	idempotency map[string]string // Job IDs by idempotency key
+	closed      bool              // Set by Shutdown, after which no jobs are accepted
+
+	ctx     context.Context // Parent of every job, canceled when Shutdown gives up waiting
+	stop    context.CancelFunc
+	workers sync.WaitGroup // Jobs in progress, including their webhooks
+}
+
+// New returns a Server configured by cfg
+func New(cfg Config) *Server {
+	if cfg.MaxRequestBytes <= 0 {
+		cfg.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = runtime.NumCPU()
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = DefaultJobTimeout
+	}
+	if cfg.MaxQueuedJobs <= 0 {
+		cfg.MaxQueuedJobs = DefaultMaxQueuedJobs
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.ResultTTL <= 0 {
+		cfg.ResultTTL = DefaultResultTTL
+	}
+	if cfg.WebhookClient == nil {
+		cfg.WebhookClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.WebhookRetries <= 0 {
+		cfg.WebhookRetries = DefaultWebhookRetries
+	}
+	if cfg.WebhookBackoff <= 0 {
+		cfg.WebhookBackoff = DefaultWebhookBackoff
+	}
+
+	s := &Server{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxConcurrent),
+		mux:   http.NewServeMux(),
+
+		jobs:        make(map[string]*asyncJob),
+		idempotency: make(map[string]string),
+	}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	s.mux.HandleFunc("POST /pdf", s.handleRender(wkhtmltox.PDFConverter))
+	s.mux.HandleFunc("POST /image", s.handleRender(wkhtmltox.ImageConverter))
+	s.mux.HandleFunc("POST /jobs", s.handleCreateJob)
+	s.mux.HandleFunc("GET /jobs/{id}", s.handleGetJob)
+	s.mux.HandleFunc("GET /jobs/{id}/result", s.handleGetJobResult)
+	s.mux.HandleFunc("DELETE /jobs/{id}", s.handleDeleteJob)
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+
+	return s
+}
+
+// Shutdown stops accepting jobs and waits for the jobs in progress, including
+// their webhooks, to finish. If ctx is done first, the remaining jobs are
+// canceled and Shutdown returns the context's error once they have stopped.
+// Synchronous renders are drained by shutting down the http.Server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.jobsMu.Lock()
+	s.closed = true
+	s.jobsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// statusError is an error with the HTTP status it should be answered with
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &statusError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	status, resp := newErrorResponse(err)
+	if status >= http.StatusInternalServerError {
+		s.cfg.Logger.Printf("server: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// decodedRequest is a request read by decodeRequest
+type decodedRequest struct {
+	JobRequest
+	bundle *wkhtmltox.Bundle // Files uploaded in a multipart body, or nil
+	hash   string            // Digest of the request, compared for idempotency keys
+}
+
+// decodeRequest reads a JSON body, or a multipart/form-data body whose fields
+// are named after the JSON fields and whose "files" and "bundle" parts are
+// unpacked into a bundle, enforcing the request size limit
+func (s *Server) decodeRequest(w http.ResponseWriter, r *http.Request) (*decodedRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxRequestBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return s.decodeMultipart(body, params["boundary"])
+	}
+
+	dr := &decodedRequest{}
+	if err := json.Unmarshal(body, &dr.JobRequest); err != nil {
+		return nil, badRequest("decoding request: %v", err)
+	}
+
+	sum := sha256.Sum256(body)
+	dr.hash = hex.EncodeToString(sum[:])
+
+	return dr, nil
+}
+
+// decodeMultipart reads a multipart/form-data body. Each "files" part is
+// added to the bundle under its file name, which may include directories,
+// and each "bundle" part is unpacked as a zip archive.
+func (s *Server) decodeMultipart(body []byte, boundary string) (*decodedRequest, error) {
+	dr := &decodedRequest{}
+	fail := func(err error) (*decodedRequest, error) {
+		if dr.bundle != nil {
+			dr.bundle.Close()
+		}
+		return nil, err
+	}
+
+	// The boundary differs between otherwise identical requests, so the
+	// digest covers the parts rather than the raw body
+	digest := sha256.New()
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(badRequest("decoding request: %v", err))
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return fail(badRequest("decoding request: %v", err))
+		}
+
+		// Part.FileName drops directories, which bundles need
+		_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		filename := params["filename"]
+		fmt.Fprintf(digest, "%q %q %d\n", part.FormName(), filename, len(data))
+		digest.Write(data)
+
+		switch part.FormName() {
+		case "kind":
+			dr.Kind = wkhtmltox.ConverterKind(data)
+		case "url":
+			dr.URL = string(data)
+		case "html":
+			dr.HTML = string(data)
+		case "entry":
+			dr.Entry = string(data)
+		case "callback_url":
+			dr.CallbackURL = string(data)
+		case "options":
+			dr.Options = json.RawMessage(data)
+		case "files", "bundle":
+			if dr.bundle == nil {
+				if dr.bundle, err = wkhtmltox.NewBundle(s.cfg.TempDir, s.cfg.BundleLimits); err != nil {
+					return fail(err)
+				}
+			}
+
+			if part.FormName() == "files" {
+				err = dr.bundle.Add(filename, bytes.NewReader(data))
+			} else {
+				err = dr.bundle.AddZip(bytes.NewReader(data), int64(len(data)))
+			}
+			if err != nil {
+				return fail(err)
+			}
+		default:
+			return fail(badRequest("unknown field %q", part.FormName()))
+		}
+	}
+
+	dr.hash = hex.EncodeToString(digest.Sum(nil))
+
+	return dr, nil
+}
+
+// checkServerOptions rejects the options clients may not send, because they
+// name paths on the server or widen the files the converter may read. It runs
+// on decoded options, as encoding/json matches keys case-insensitively.
+func checkServerOptions(allow *[]string, cacheDir *string, localFileAccess *bool) error {
+	switch {
+	case allow != nil:
+		return badRequest("option %q is set by the server", "allow")
+	case cacheDir != nil:
+		return badRequest("option %q is set by the server", "cache_dir")
+	case localFileAccess != nil:
+		return badRequest("option %q is set by the server", "local_file_access")
+	}
+
+	return nil
+}
+
+// stagedRender is a validated request whose input has been written to disk
+type stagedRender struct {
+	job         wkhtmltox.Job
+	contentType string
+	dir         string
+	bundle      *wkhtmltox.Bundle
+}
+
+// cleanup removes the staged input and any output
+func (sr *stagedRender) cleanup() {
+	if sr.dir != "" {
+		os.RemoveAll(sr.dir)
+	}
+	if sr.bundle != nil {
+		sr.bundle.Close()
+	}
+}
+
+// stage validates req and writes its input to a temporary directory, which
+// the caller must remove with cleanup. The stagedRender takes ownership of
+// bundle, which holds any files uploaded alongside req. The converter may only
+// read local files in the staging directory, or the bundle for bundled inputs.
+func (s *Server) stage(kind wkhtmltox.ConverterKind, req RenderRequest, bundle *wkhtmltox.Bundle) (_ *stagedRender, err error) {
+	sr := &stagedRender{bundle: bundle}
+	defer func() {
+		if err != nil {
+			sr.cleanup()
+		}
+	}()
+
+	if len(req.Bundle) > 0 {
+		if sr.bundle == nil {
+			if sr.bundle, err = wkhtmltox.NewBundle(s.cfg.TempDir, s.cfg.BundleLimits); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := sr.bundle.AddZip(bytes.NewReader(req.Bundle), int64(len(req.Bundle))); err != nil {
+			return nil, err
+		}
+	}
+
+	sources := 0
+	for _, given := range []bool{req.URL != "", req.HTML != "", sr.bundle != nil} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, badRequest("exactly one of url, html and bundle is required")
+	}
+
+	if req.URL != "" {
+		scheme := strings.ToLower(strings.SplitN(req.URL, ":", 2)[0])
+		if scheme != "http" && scheme != "https" {
+			return nil, badRequest("url must be http or https")
+		}
+	}
+
+	options := req.Options
+	if len(options) == 0 {
+		options = json.RawMessage("{}")
+	}
+
+	var imageOpts wkhtmltox.ImageOptions
+	var pdfOpts wkhtmltox.PDFOptions
+	var output string
+	if kind == wkhtmltox.ImageConverter {
+		if err := json.Unmarshal(options, &imageOpts); err != nil {
+			return nil, badRequest("decoding options: %v", err)
+		}
+		if err := checkServerOptions(imageOpts.Allow, imageOpts.CacheDir, imageOpts.LocalFileAccess); err != nil {
+			return nil, err
+		}
+
+		format := "png"
+		if imageOpts.Format != nil {
+			format = strings.ToLower(*imageOpts.Format)
+		}
+		if sr.contentType = wkhtmltox.ImageContentType(format); sr.contentType == "" {
+			return nil, badRequest("unsupported image format %q", format)
+		}
+		imageOpts.Format = &format
+		output = "output." + format
+	} else {
+		if err := json.Unmarshal(options, &pdfOpts); err != nil {
+			return nil, badRequest("decoding options: %v", err)
+		}
+		if err := checkServerOptions(pdfOpts.Allow, pdfOpts.CacheDir, pdfOpts.LocalFileAccess); err != nil {
+			return nil, err
+		}
+
+		sr.contentType = "application/pdf"
+		output = "output.pdf"
+	}
+
+	if sr.dir, err = os.MkdirTemp(s.cfg.TempDir, "wkhtmld"); err != nil {
+		return nil, err
+	}
+
+	input := req.URL
+	switch {
+	case req.HTML != "":
+		input = filepath.Join(sr.dir, "index.html")
+		if err := os.WriteFile(input, []byte(req.HTML), 0600); err != nil {
+			return nil, err
+		}
+	case sr.bundle != nil:
+		if input, err = sr.bundle.Input(req.Entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// The page may only read the files staged for it
+	allowed := []string{sr.dir}
+	if sr.bundle != nil {
+		allowed = []string{sr.bundle.Dir()}
+	}
+	localFileAccess := false
+	imageOpts.Allow, imageOpts.LocalFileAccess = &allowed, &localFileAccess
+	pdfOpts.Allow, pdfOpts.LocalFileAccess = &allowed, &localFileAccess
+
+	if kind == wkhtmltox.ImageConverter {
+		sr.job, err = wkhtmltox.NewImageJob(input, filepath.Join(sr.dir, output), &imageOpts)
+	} else {
+		sr.job, err = wkhtmltox.NewPDFJob(input, filepath.Join(sr.dir, output), &pdfOpts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := sr.job.Command(); err != nil {
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+// render runs the converter of a staged request using ex and reads the output
+func (s *Server) render(ctx context.Context, ex wkhtmltox.Executor, sr *stagedRender) (*wkhtmltox.Result, error) {
+	out, err := sr.job.GenerateContext(ctx, ex)
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" && ctx.Err() == nil {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	data, err := os.ReadFile(sr.job.Output())
+	if err != nil {
+		return nil, err
+	}
+
+	return &wkhtmltox.Result{Data: data, ContentType: sr.contentType, Warnings: wkhtmltox.ParseWarnings(out)}, nil
+}
+
+func (s *Server) handleRender(kind wkhtmltox.ConverterKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			s.writeError(w, &statusError{status: http.StatusServiceUnavailable, err: errors.New("too many conversions in progress")})
+			return
+		}
+
+		req, err := s.decodeRequest(w, r)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		sr, err := s.stage(kind, req.RenderRequest, req.bundle)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		defer sr.cleanup()
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+		defer cancel()
+
+		result, err := s.render(ctx, s.cfg.Executor, sr)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		writeResult(w, result)
+	}
+}
+
+func writeResult(w http.ResponseWriter, result *wkhtmltox.Result) {
+	for _, warning := range result.Warnings {
+		w.Header().Add("X-Wkhtmltox-Warning", warning)
+	}
+	w.Header().Set("Content-Type", result.ContentType)
+	w.Write(result.Data)
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	var problems []string
+	for _, kind := range []wkhtmltox.ConverterKind{wkhtmltox.PDFConverter, wkhtmltox.ImageConverter} {
+		binary, _ := kind.Binary()
+		if _, _, err := wkhtmltox.LookupConverter(binary); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", binary, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		s.writeError(w, &statusError{status: http.StatusServiceUnavailable, err: errors.New(strings.Join(problems, "; "))})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
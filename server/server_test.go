@@ -0,0 +1,218 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/server"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func post(t *testing.T, h http.Handler, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+
+	return w
+}
+
+func errorOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	var resp server.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("expected an error response, got %q", w.Body.String())
+	}
+
+	return resp.Error
+}
+
+func TestRenderPDF(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{
+		OutputFile: wkhtmltoxtest.PDF(1),
+		Stderr:     []byte("Warning: Failed to load logo.png (ignore)\n"),
+	})
+	h := server.New(server.Config{Executor: ex})
+
+	w := post(t, h, "/pdf", `{"html":"<p>hello</p>","options":{"title":"Report"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if w.Header().Get("Content-Type") != "application/pdf" || w.Body.String() != string(wkhtmltoxtest.PDF(1)) {
+		t.Fatalf("unexpected response %s: %q", w.Header().Get("Content-Type"), w.Body)
+	}
+
+	if w.Header().Get("X-Wkhtmltox-Warning") != "Failed to load logo.png (ignore)" {
+		t.Fatalf("expected the warning to be returned, got %v", w.Header())
+	}
+
+	args := ex.Calls()[0].Args
+	input := args[len(args)-2]
+	if filepath.Base(input) != "index.html" || args[len(args)-4] != "--title" || args[len(args)-3] != "Report" {
+		t.Fatalf("unexpected arguments '%s'", args)
+	}
+
+	if args[0] != "--allow" || args[1] != filepath.Dir(input) || args[2] != "--disable-local-file-access" {
+		t.Fatalf("expected local files to be restricted to %s, got '%s'", filepath.Dir(input), args)
+	}
+}
+
+func TestRenderImageFormat(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.JPEG(8, 8)})
+	h := server.New(server.Config{Executor: ex})
+
+	w := post(t, h, "/image", `{"url":"https://example.com","options":{"format":"jpg"}}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected a JPEG, got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+}
+
+func TestRenderBadRequests(t *testing.T) {
+	h := server.New(server.Config{Executor: wkhtmltoxtest.NewExecutor(), MaxRequestBytes: 64})
+
+	for body, status := range map[string]int{
+		`{"html":"<p>hi</p>","url":"https://example.com"}`: http.StatusBadRequest,
+		`{}`:                              http.StatusBadRequest,
+		`{"url":"file:///etc/passwd"}`:    http.StatusBadRequest,
+		`{"url":"https://example.com","x`: http.StatusBadRequest,
+		`{"html":"` + strings.Repeat("a", 100) + `"}`: http.StatusRequestEntityTooLarge,
+	} {
+		if w := post(t, h, "/pdf", body); w.Code != status || errorOf(t, w) == "" {
+			t.Fatalf("expected status %d for %s, got %d: %s", status, body, w.Code, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pdf", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+}
+
+func TestRenderBlocksLocalFiles(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	h := server.New(server.Config{})
+
+	w := post(t, h, "/pdf", `{"html":"<iframe src=\"file:///etc/passwd\"></iframe>"}`)
+	if w.Code != http.StatusBadGateway || !strings.Contains(errorOf(t, w), "Blocked access to file /etc/passwd") {
+		t.Fatalf("expected status 502, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRenderServerOptions(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor()
+	h := server.New(server.Config{Executor: ex})
+
+	for _, options := range []string{
+		`{"cache_dir":"/"}`, `{"allow":["/"]}`, `{"local_file_access":true}`,
+		`{"Cache_Dir":"/etc/evil"}`, `{"ALLOW":["/"]}`, `{"Local_File_Access":true}`,
+	} {
+		for _, path := range []string{"/pdf", "/image"} {
+			w := post(t, h, path, `{"html":"<p>hi</p>","options":`+options+`}`)
+			if w.Code != http.StatusBadRequest || !strings.Contains(errorOf(t, w), "set by the server") {
+				t.Fatalf("expected status 400 for %s, got %d: %s", options, w.Code, w.Body)
+			}
+		}
+	}
+
+	if calls := ex.Calls(); len(calls) != 0 {
+		t.Fatalf("expected no conversions, got %d", len(calls))
+	}
+}
+
+func TestRenderFailures(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(
+		wkhtmltoxtest.Response{ExitCode: 1, Stderr: []byte("HostNotFoundError")},
+		wkhtmltoxtest.Response{Delay: time.Minute},
+	)
+	h := server.New(server.Config{Executor: ex, Timeout: 10 * time.Millisecond})
+
+	if w := post(t, h, "/pdf", `{"url":"https://example.com"}`); w.Code != http.StatusBadGateway || !strings.Contains(errorOf(t, w), "HostNotFoundError") {
+		t.Fatalf("expected status 502, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := post(t, h, "/pdf", `{"url":"https://example.com"}`); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRenderBackpressure(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Delay: 200 * time.Millisecond})
+	h := server.New(server.Config{Executor: ex, MaxConcurrent: 1})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Post(srv.URL+"/pdf", "application/json", strings.NewReader(`{"url":"https://example.com"}`))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	// wait for the first conversion to start
+	for len(ex.Calls()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err := http.Post(srv.URL+"/pdf", "application/json", bytes.NewReader([]byte(`{"url":"https://example.com"}`)))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	<-done
+
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected status 503 with Retry-After, got %d", resp.StatusCode)
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	h := server.New(server.Config{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 without converters, got %d", w.Code)
+	}
+
+	wkhtmltoxtest.InstallFakeConverters(t)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 with converters, got %d: %s", w.Code, w.Body)
+	}
+}
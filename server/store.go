@@ -0,0 +1,280 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+// ErrNotFound is returned by a ResultStore for unknown or expired results
+var ErrNotFound = errors.New("server: result not found")
+
+var resultIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ResultStore keeps the results of asynchronous jobs until they expire.
+// Implementations must be safe for concurrent use.
+type ResultStore interface {
+	// Put stores r under id, replacing any previous result, for ttl
+	Put(ctx context.Context, id string, r wkhtmltox.Result, ttl time.Duration) error
+
+	// Get returns the result stored under id, or ErrNotFound if there is
+	// none or it has expired
+	Get(ctx context.Context, id string) (wkhtmltox.Result, error)
+
+	// Delete removes the result stored under id, if any
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryEntry struct {
+	result  wkhtmltox.Result
+	expires time.Time
+}
+
+// MemoryStore is a ResultStore that keeps results in memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Put implements ResultStore. Expired results are discarded as a side effect.
+func (ms *MemoryStore) Put(ctx context.Context, id string, r wkhtmltox.Result, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range ms.entries {
+		if !now.Before(entry.expires) {
+			delete(ms.entries, key)
+		}
+	}
+
+	r.Data = append([]byte(nil), r.Data...)
+	r.Warnings = append([]string(nil), r.Warnings...)
+	ms.entries[id] = memoryEntry{result: r, expires: now.Add(ttl)}
+
+	return nil
+}
+
+// Get implements ResultStore
+func (ms *MemoryStore) Get(ctx context.Context, id string) (wkhtmltox.Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[id]
+	if !ok {
+		return wkhtmltox.Result{}, ErrNotFound
+	}
+
+	if !time.Now().Before(entry.expires) {
+		delete(ms.entries, id)
+		return wkhtmltox.Result{}, ErrNotFound
+	}
+
+	return entry.result, nil
+}
+
+// Delete implements ResultStore
+func (ms *MemoryStore) Delete(ctx context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.entries, id)
+
+	return nil
+}
+
+// fileMeta is kept beside each result written by a FileStore
+type fileMeta struct {
+	ContentType string    `json:"content_type"`
+	Warnings    []string  `json:"warnings,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// FileStore is a ResultStore that keeps results as files in a directory
+// rather than in memory. Jobs are still tracked in memory, so a result can
+// only be downloaded from the server that ran its job, and not after a restart.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore that keeps results in dir, creating it if
+// needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (fs *FileStore) paths(id string) (string, string, error) {
+	if !resultIDPattern.MatchString(id) {
+		return "", "", errors.New("server: invalid result id")
+	}
+
+	base := filepath.Join(fs.dir, id)
+
+	return base + ".data", base + ".json", nil
+}
+
+// Put implements ResultStore. Files are written atomically, and expired
+// results are discarded as a side effect.
+func (fs *FileStore) Put(ctx context.Context, id string, r wkhtmltox.Result, ttl time.Duration) error {
+	dataPath, metaPath, err := fs.paths(id)
+	if err != nil {
+		return err
+	}
+
+	fs.sweep()
+
+	meta, err := json.Marshal(fileMeta{
+		ContentType: r.ContentType,
+		Warnings:    r.Warnings,
+		ExpiresAt:   time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The data is written before the metadata, which is what makes a result
+	// visible to Get
+	if err := writeFileAtomic(dataPath, r.Data); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(metaPath, meta)
+}
+
+// Get implements ResultStore
+func (fs *FileStore) Get(ctx context.Context, id string) (wkhtmltox.Result, error) {
+	dataPath, metaPath, err := fs.paths(id)
+	if err != nil {
+		return wkhtmltox.Result{}, ErrNotFound
+	}
+
+	raw, err := os.ReadFile(metaPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return wkhtmltox.Result{}, ErrNotFound
+	} else if err != nil {
+		return wkhtmltox.Result{}, err
+	}
+
+	var meta fileMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return wkhtmltox.Result{}, err
+	}
+
+	if !time.Now().Before(meta.ExpiresAt) {
+		fs.remove(dataPath, metaPath)
+		return wkhtmltox.Result{}, ErrNotFound
+	}
+
+	data, err := os.ReadFile(dataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return wkhtmltox.Result{}, ErrNotFound
+	} else if err != nil {
+		return wkhtmltox.Result{}, err
+	}
+
+	return wkhtmltox.Result{Data: data, ContentType: meta.ContentType, Warnings: meta.Warnings}, nil
+}
+
+// Delete implements ResultStore
+func (fs *FileStore) Delete(ctx context.Context, id string) error {
+	dataPath, metaPath, err := fs.paths(id)
+	if err != nil {
+		return nil
+	}
+
+	return fs.remove(dataPath, metaPath)
+}
+
+func (fs *FileStore) remove(dataPath string, metaPath string) error {
+	// The metadata goes first so a half-removed result is never visible
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.Remove(dataPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// sweep removes expired results
+func (fs *FileStore) sweep() {
+	matches, _ := filepath.Glob(filepath.Join(fs.dir, "*.json"))
+	now := time.Now()
+
+	for _, metaPath := range matches {
+		raw, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+
+		var meta fileMeta
+		if json.Unmarshal(raw, &meta) != nil || now.Before(meta.ExpiresAt) {
+			continue
+		}
+
+		fs.remove(strings.TrimSuffix(metaPath, ".json")+".data", metaPath)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file beside path and renames it
+// into place, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/server"
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+func testResultStore(t *testing.T, store server.ResultStore) {
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	want := wkhtmltox.Result{Data: []byte("%PDF"), ContentType: "application/pdf", Warnings: []string{"slow"}}
+	if err := store.Put(ctx, "a", want, time.Hour); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got, err := store.Get(ctx, "a")
+	if err != nil || string(got.Data) != "%PDF" || got.ContentType != "application/pdf" || len(got.Warnings) != 1 {
+		t.Fatalf("unexpected result %+v, %v", got, err)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Delete, got %v", err)
+	}
+
+	if err := store.Put(ctx, "b", want, 20*time.Millisecond); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := store.Get(ctx, "b"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after expiry, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testResultStore(t, server.NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := server.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	testResultStore(t, store)
+
+	if err := store.Put(context.Background(), "../escape", wkhtmltox.Result{}, time.Hour); err == nil {
+		t.Fatal("expected an error for an id outside the directory")
+	}
+}
+
+func TestFileStorePersists(t *testing.T) {
+	dir := t.TempDir()
+
+	first, _ := server.NewFileStore(dir)
+	if err := first.Put(context.Background(), "a", wkhtmltox.Result{Data: []byte("png"), ContentType: "image/png"}, time.Hour); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	second, _ := server.NewFileStore(dir)
+	got, err := second.Get(context.Background(), "a")
+	if err != nil || string(got.Data) != "png" || got.ContentType != "image/png" {
+		t.Fatalf("unexpected result %+v, %v", got, err)
+	}
+}
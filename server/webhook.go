@@ -0,0 +1,148 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/api"
+)
+
+// Defaults for zero webhook Config fields
+const (
+	DefaultWebhookRetries = 5
+	DefaultWebhookBackoff = time.Second
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body
+const SignatureHeader = api.SignatureHeader
+
+// WebhookPayload is the body POSTed to a job's callback URL when it finishes
+type WebhookPayload = api.WebhookPayload
+
+// DeliveryAttempt records one attempt to deliver a webhook
+type DeliveryAttempt = api.DeliveryAttempt
+
+// SignPayload returns the SignatureHeader value for body: "sha256=" followed
+// by the hex HMAC-SHA256 of body keyed with secret
+func SignPayload(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature, the SignatureHeader of a
+// webhook, matches body. Receivers should verify the raw body before
+// decoding it.
+func VerifySignature(secret []byte, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignPayload(secret, body)), []byte(signature))
+}
+
+// deliverWebhook POSTs the outcome of a job to its callback URL, retrying
+// with exponential backoff until a 2xx response, the retries run out or ctx
+// is done. Every attempt is recorded on the job.
+func (s *Server) deliverWebhook(ctx context.Context, callbackURL string, j *asyncJob, payload WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.cfg.Logger.Printf("server: job %s: encoding webhook: %v", payload.JobID, err)
+		return
+	}
+
+	backoff := s.cfg.WebhookBackoff
+	for attempt := 0; attempt <= s.cfg.WebhookRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				s.cfg.Logger.Printf("server: job %s: stopped retrying webhook to %s: %v", payload.JobID, callbackURL, ctx.Err())
+				return
+			}
+			backoff *= 2
+		}
+
+		code, err := s.postWebhook(ctx, callbackURL, body)
+		record := DeliveryAttempt{At: time.Now().UTC(), StatusCode: code}
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		s.jobsMu.Lock()
+		j.status.Deliveries = append(j.status.Deliveries, record)
+		s.jobsMu.Unlock()
+
+		if err == nil {
+			return
+		}
+	}
+
+	s.cfg.Logger.Printf("server: job %s: giving up on webhook to %s", payload.JobID, callbackURL)
+}
+
+// postWebhook makes a single delivery attempt, returning the response status
+// and an error unless it was 2xx
+func (s *Server) postWebhook(ctx context.Context, callbackURL string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.cfg.WebhookSecret) > 0 {
+		req.Header.Set(SignatureHeader, SignPayload(s.cfg.WebhookSecret, body))
+	}
+
+	resp, err := s.cfg.WebhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback responded %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// resultURL returns where the result of a job can be downloaded
+func (s *Server) resultURL(id string) string {
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/jobs/" + id + "/result"
+}
+
+// checkCallbackURL rejects callback URLs that are not http or https
+func checkCallbackURL(callbackURL string) error {
+	scheme := strings.ToLower(strings.SplitN(callbackURL, ":", 2)[0])
+	if scheme != "http" && scheme != "https" {
+		return badRequest("callback_url must be http or https")
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/server"
+)
+
+func TestSignPayload(t *testing.T) {
+	secret := []byte("key")
+	body := []byte("The quick brown fox jumps over the lazy dog")
+
+	// Known HMAC-SHA256 test vector
+	expected := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if sig := server.SignPayload(secret, body); sig != expected {
+		t.Fatalf("expected %s, got %s", expected, sig)
+	}
+
+	if !server.VerifySignature(secret, body, expected) {
+		t.Fatal("expected the signature to verify")
+	}
+
+	if server.VerifySignature([]byte("other"), body, expected) || server.VerifySignature(secret, append(body, '.'), expected) {
+		t.Fatal("expected a mismatched signature to fail")
+	}
+}
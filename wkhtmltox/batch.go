@@ -0,0 +1,213 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status of a record in a batch report
+const (
+	BatchSucceeded = "succeeded"
+	BatchFailed    = "failed"
+)
+
+// Longest manifest record RunBatch accepts
+const maxBatchRecordSize = 1 << 20
+
+// BatchOptions configures RunBatch
+type BatchOptions struct {
+	Concurrency int           // Conversions run at once, at least 1
+	Timeout     time.Duration // Time allowed for each conversion, 0 for no limit
+	Executor    Executor      // How to run converters, nil for DefaultExecutor
+	Resume      io.Reader     // Report of an earlier run whose successful records are skipped
+}
+
+// BatchResult is a single line of a batch report
+type BatchResult struct {
+	Line       int           `json:"line"`               // Line of the record in the manifest
+	Kind       ConverterKind `json:"kind,omitempty"`     // Converter that ran
+	Input      string        `json:"input,omitempty"`    // Input of the record
+	Output     string        `json:"output,omitempty"`   // Output of the record
+	Status     string        `json:"status"`             // BatchSucceeded or BatchFailed
+	Error      string        `json:"error,omitempty"`    // Why the record failed
+	Warnings   []string      `json:"warnings,omitempty"` // Warnings printed by the converter
+	DurationMS int64         `json:"duration_ms"`        // How long the conversion took
+}
+
+// BatchSummary counts what happened to the records of a batch
+type BatchSummary struct {
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+func batchKey(kind ConverterKind, input string, output string) string {
+	return strings.Join([]string{string(kind), input, output}, "\x00")
+}
+
+// completedBatchRecords reads a report and returns the records that succeeded
+func completedBatchRecords(report io.Reader) (map[string]bool, error) {
+	completed := make(map[string]bool)
+
+	scanner := bufio.NewScanner(report)
+	scanner.Buffer(nil, maxBatchRecordSize)
+	for scanner.Scan() {
+		var result BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			// A line cut short by an interruption; its record is run again
+			continue
+		}
+
+		if result.Status == BatchSucceeded {
+			completed[batchKey(result.Kind, result.Input, result.Output)] = true
+		}
+	}
+
+	return completed, scanner.Err()
+}
+
+// RunBatch runs every Job in a JSON Lines manifest, in the format Job
+// marshals to, and writes a BatchResult for each to report as it completes.
+// Records that succeeded in the Resume report are skipped and not reported
+// again, so an interrupted batch can be resumed by appending to its report.
+// A last line cut short by the interruption is run again; truncate the report
+// to its last newline before appending so that it stays valid JSON Lines.
+func RunBatch(ctx context.Context, manifest io.Reader, report io.Writer, opts BatchOptions) (BatchSummary, error) {
+	var summary BatchSummary
+
+	completed := make(map[string]bool)
+	if opts.Resume != nil {
+		var err error
+		if completed, err = completedBatchRecords(opts.Resume); err != nil {
+			return summary, err
+		}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		writeErr error
+	)
+	enc := json.NewEncoder(report)
+	record := func(result BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if result.Status == BatchSucceeded {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+
+		if err := enc.Encode(result); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+
+	slots := make(chan struct{}, concurrency)
+	scanner := bufio.NewScanner(manifest)
+	scanner.Buffer(nil, maxBatchRecordSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			record(BatchResult{Line: line, Status: BatchFailed, Error: err.Error()})
+			continue
+		}
+
+		if completed[batchKey(job.Kind(), job.Input(), job.Output())] {
+			mu.Lock()
+			summary.Skipped++
+			mu.Unlock()
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(line int, job Job) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			record(runBatchJob(ctx, line, job, opts))
+		}(line, job)
+	}
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		return summary, err
+	}
+
+	if writeErr != nil {
+		return summary, writeErr
+	}
+
+	return summary, ctx.Err()
+}
+
+func runBatchJob(ctx context.Context, line int, job Job, opts BatchOptions) BatchResult {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	result := BatchResult{
+		Line:   line,
+		Kind:   job.Kind(),
+		Input:  job.Input(),
+		Output: job.Output(),
+		Status: BatchSucceeded,
+	}
+
+	start := time.Now()
+	out, err := job.GenerateContext(ctx, opts.Executor)
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.Warnings = ParseWarnings(out)
+
+	if err != nil {
+		result.Status = BatchFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
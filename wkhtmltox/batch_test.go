@@ -0,0 +1,109 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func readBatchReport(t *testing.T, report *bytes.Buffer) map[int]wkhtmltox.BatchResult {
+	results := make(map[int]wkhtmltox.BatchResult)
+
+	scanner := bufio.NewScanner(report)
+	for scanner.Scan() {
+		var result wkhtmltox.BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		results[result.Line] = result
+	}
+
+	return results
+}
+
+func TestRunBatch(t *testing.T) {
+	manifest := strings.NewReader(strings.ReplaceAll(`{"kind":"pdf","input":"http://example.com/1","output":"/tmp/1.pdf","options":{"page_size":"A4"}}
+{"kind":"image","input":"http://example.com/2","output":"/tmp/2.png"}
+
+{"kind":"gif","input":"http://example.com/3","output":"/tmp/3.gif"}
+{"kind":"pdf","input":"http://example.com/4","output":"/tmp/4.pdf"}
+`, "/tmp", t.TempDir()))
+	ex := wkhtmltoxtest.NewExecutor(
+		wkhtmltoxtest.Response{Stderr: []byte("Warning: Failed to load logo.png (ignore)\n"), OutputFile: wkhtmltoxtest.PDF(1)},
+		wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(8, 8)},
+		wkhtmltoxtest.Response{ExitCode: 1},
+	)
+
+	var report bytes.Buffer
+	summary, err := wkhtmltox.RunBatch(context.Background(), manifest, &report, wkhtmltox.BatchOptions{Executor: ex})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if summary.Succeeded != 2 || summary.Failed != 2 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	results := readBatchReport(t, &report)
+	if r := results[1]; r.Status != wkhtmltox.BatchSucceeded || len(r.Warnings) != 1 || r.Kind != wkhtmltox.PDFConverter {
+		t.Fatalf("unexpected result %+v", r)
+	}
+
+	if r := results[4]; r.Status != wkhtmltox.BatchFailed || !strings.Contains(r.Error, "gif") {
+		t.Fatalf("unexpected result %+v", r)
+	}
+
+	if r := results[5]; r.Status != wkhtmltox.BatchFailed || !strings.Contains(r.Error, "exited with status 1") {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
+
+func TestRunBatchResume(t *testing.T) {
+	manifest := `{"kind":"pdf","input":"http://example.com/1","output":"/tmp/1.pdf"}
+{"kind":"pdf","input":"http://example.com/2","output":"/tmp/2.pdf"}
+{"kind":"pdf","input":"http://example.com/3","output":"/tmp/3.pdf"}
+`
+	previous := `{"line":1,"kind":"pdf","input":"http://example.com/1","output":"/tmp/1.pdf","status":"succeeded","duration_ms":5}
+{"line":2,"kind":"pdf","input":"http://example.com/2","output":"/tmp/2.pdf","status":"failed","error":"boom","duration_ms":5}
+{"line":3,"kind":"pdf","inp`
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	dir := t.TempDir()
+
+	var report bytes.Buffer
+	opts := wkhtmltox.BatchOptions{Concurrency: 4, Executor: ex, Resume: strings.NewReader(strings.ReplaceAll(previous, "/tmp", dir))}
+	summary, err := wkhtmltox.RunBatch(context.Background(), strings.NewReader(strings.ReplaceAll(manifest, "/tmp", dir)), &report, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if summary.Succeeded != 2 || summary.Skipped != 1 || len(ex.Calls()) != 2 {
+		t.Fatalf("expected records 2 and 3 to run again, got %+v", summary)
+	}
+
+	if _, ran := readBatchReport(t, &report)[1]; ran {
+		t.Fatal("expected record 1 not to be reported again")
+	}
+}
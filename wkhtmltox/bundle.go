@@ -0,0 +1,270 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults for zero BundleLimits fields
+const (
+	DefaultBundleMaxBytes = 50 << 20
+	DefaultBundleMaxFiles = 1000
+)
+
+// DefaultBundleEntry is the file rendered when no entry is named
+const DefaultBundleEntry = "index.html"
+
+// BundleLimits bound what a Bundle may hold
+type BundleLimits struct {
+	MaxBytes int64 // Total size of all files, and of any archive, DefaultBundleMaxBytes if zero
+	MaxFiles int   // Number of files, DefaultBundleMaxFiles if zero
+}
+
+// BundleError is returned when a file cannot be added to a Bundle because of
+// its name or a limit
+type BundleError struct {
+	Name   string // File or archive that was rejected
+	Reason string // Why it was rejected
+}
+
+func (e *BundleError) Error() string {
+	return fmt.Sprintf("wkhtmltox: bundle file %q rejected: %s", e.Name, e.Reason)
+}
+
+// Bundle is an HTML document and the assets it links to, such as CSS, fonts
+// and images, unpacked into a private temporary directory so that relative
+// links resolve when the entry file is rendered. GenerateBundle renders it
+// with local file access limited to the Bundle, so that it cannot read other
+// files on the host.
+type Bundle struct {
+	dir    string
+	limits BundleLimits
+	bytes  int64
+	files  map[string]bool
+}
+
+// NewBundle creates an empty Bundle in a new directory under tempDir, or
+// os.TempDir() if it is empty. The Bundle must be closed to remove it.
+func NewBundle(tempDir string, limits BundleLimits) (*Bundle, error) {
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultBundleMaxBytes
+	}
+	if limits.MaxFiles <= 0 {
+		limits.MaxFiles = DefaultBundleMaxFiles
+	}
+
+	dir, err := os.MkdirTemp(tempDir, "wkhtmltox-bundle")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bundle{dir: dir, limits: limits, files: make(map[string]bool)}, nil
+}
+
+// Dir returns the directory the Bundle is unpacked into
+func (b *Bundle) Dir() string {
+	return b.dir
+}
+
+// Len returns the number of files in the Bundle
+func (b *Bundle) Len() int {
+	return len(b.files)
+}
+
+// cleanBundleName checks that name is a relative, slash-separated path that
+// stays inside the bundle, and returns it cleaned
+func cleanBundleName(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", &BundleError{Name: name, Reason: "name is empty"}
+	case strings.ContainsRune(name, 0):
+		return "", &BundleError{Name: name, Reason: "name contains a NUL byte"}
+	case strings.Contains(name, `\`):
+		return "", &BundleError{Name: name, Reason: "name contains a backslash"}
+	}
+
+	cleaned := path.Clean(name)
+	if !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", &BundleError{Name: name, Reason: "path escapes the bundle"}
+	}
+
+	return cleaned, nil
+}
+
+// Add writes the contents of r to the file name, a slash-separated path
+// relative to the root of the Bundle
+func (b *Bundle) Add(name string, r io.Reader) error {
+	cleaned, err := cleanBundleName(name)
+	if err != nil {
+		return err
+	}
+
+	if b.files[cleaned] {
+		return &BundleError{Name: name, Reason: "file already added"}
+	}
+	if len(b.files) >= b.limits.MaxFiles {
+		return &BundleError{Name: name, Reason: fmt.Sprintf("bundle has more than %d files", b.limits.MaxFiles)}
+	}
+
+	target := filepath.Join(b.dir, filepath.FromSlash(cleaned))
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	// O_EXCL refuses to follow anything already at the target, such as a
+	// directory created for another file
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return &BundleError{Name: name, Reason: err.Error()}
+	}
+	b.files[cleaned] = true
+
+	remaining := b.limits.MaxBytes - b.bytes
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	b.bytes += n
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if n > remaining {
+		return &BundleError{Name: name, Reason: fmt.Sprintf("bundle is larger than %d bytes", b.limits.MaxBytes)}
+	}
+
+	return nil
+}
+
+// AddZip unpacks a zip archive of size bytes into the Bundle. Directories are
+// skipped, and symbolic links and other special files are rejected.
+func (b *Bundle) AddZip(r io.ReaderAt, size int64) error {
+	if size > b.limits.MaxBytes {
+		return &BundleError{Name: "archive", Reason: fmt.Sprintf("archive is larger than %d bytes", b.limits.MaxBytes)}
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return &BundleError{Name: "archive", Reason: err.Error()}
+	}
+
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			return &BundleError{Name: zf.Name, Reason: "not a regular file"}
+		}
+
+		if err := b.addZipFile(zf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bundle) addZipFile(zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return &BundleError{Name: zf.Name, Reason: err.Error()}
+	}
+	defer rc.Close()
+
+	return b.Add(zf.Name, rc)
+}
+
+// Input returns the absolute path of the entry file, DefaultBundleEntry if
+// entry is empty, to pass to the converters as their input
+func (b *Bundle) Input(entry string) (string, error) {
+	if entry == "" {
+		entry = DefaultBundleEntry
+	}
+
+	cleaned, err := cleanBundleName(entry)
+	if err != nil {
+		return "", err
+	}
+
+	if !b.files[cleaned] {
+		return "", &BundleError{Name: entry, Reason: "entry file is not in the bundle"}
+	}
+
+	return filepath.Join(b.dir, filepath.FromSlash(cleaned)), nil
+}
+
+// Close removes the Bundle and everything in it
+func (b *Bundle) Close() error {
+	if b.dir == "" {
+		return errors.New("wkhtmltox: bundle already closed")
+	}
+
+	err := os.RemoveAll(b.dir)
+	b.dir = ""
+
+	return err
+}
+
+// sandbox returns a copy of fs that lets the converter read local files only
+// from the Bundle, replacing any local file access flags fs has
+func (b *Bundle) sandbox(fs flagSet) flagSet {
+	sandboxed := cloneFlagSet(fs)
+	if sandboxed == nil {
+		sandboxed = make(flagSet)
+	}
+	sandboxed["local-file-access"] = false
+	sandboxed["allow"] = []string{b.dir}
+
+	return sandboxed
+}
+
+// GenerateBundle performs the image conversion of entry, a file in b, with
+// local file access limited to b. ex may be nil to use DefaultExecutor.
+func (ifs *ImageFlagSet) GenerateBundle(ctx context.Context, ex Executor, b *Bundle, entry string, outputFile string) ([]byte, error) {
+	input, err := b.Input(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxed := ImageFlagSet(b.sandbox(flagSet(*ifs)))
+
+	return sandboxed.GenerateSource(ctx, ex, FileSource{Path: input}, outputFile)
+}
+
+// GenerateBundle performs the PDF conversion of entry, a file in b, with
+// local file access limited to b. ex may be nil to use DefaultExecutor.
+func (pfs *PDFFlagSet) GenerateBundle(ctx context.Context, ex Executor, b *Bundle, entry string, outputFile string) ([]byte, error) {
+	input, err := b.Input(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxed := PDFFlagSet(b.sandbox(flagSet(*pfs)))
+
+	return sandboxed.GenerateSource(ctx, ex, FileSource{Path: input}, outputFile)
+}
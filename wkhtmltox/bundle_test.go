@@ -0,0 +1,198 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+type zipEntry struct {
+	name string
+	mode fs.FileMode
+	data string
+}
+
+func buildZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		hdr.SetMode(e.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		w.Write([]byte(e.data))
+	}
+	zw.Close()
+
+	return buf.Bytes()
+}
+
+func TestBundleZip(t *testing.T) {
+	b, err := wkhtmltox.NewBundle(t.TempDir(), wkhtmltox.BundleLimits{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	archive := buildZip(t,
+		zipEntry{name: "site/", mode: fs.ModeDir | 0755},
+		zipEntry{name: "site/index.html", mode: 0644, data: `<link href="css/site.css">`},
+		zipEntry{name: "site/css/site.css", mode: 0644, data: "body {}"},
+	)
+	if err := b.AddZip(bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if b.Len() != 2 {
+		t.Fatalf("expected 2 files, got %d", b.Len())
+	}
+
+	input, err := b.Input("site/index.html")
+	if err != nil || input != filepath.Join(b.Dir(), "site", "index.html") {
+		t.Fatalf("unexpected input %q, %v", input, err)
+	}
+
+	css, err := os.ReadFile(filepath.Join(filepath.Dir(input), "css", "site.css"))
+	if err != nil || string(css) != "body {}" {
+		t.Fatalf("expected the stylesheet beside the entry, got %q, %v", css, err)
+	}
+
+	var bundleErr *wkhtmltox.BundleError
+	if _, err := b.Input(""); !errors.As(err, &bundleErr) {
+		t.Fatalf("expected a *BundleError for a missing index.html, got %v", err)
+	}
+
+	dir := b.Dir()
+	b.Close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the bundle to be removed, got %v", err)
+	}
+}
+
+func TestBundleRejectsUnsafeNames(t *testing.T) {
+	b, _ := wkhtmltox.NewBundle(t.TempDir(), wkhtmltox.BundleLimits{})
+	defer b.Close()
+
+	for _, name := range []string{
+		"",
+		"../escape.html",
+		"css/../../escape.html",
+		"/etc/passwd",
+		`..\escape.html`,
+		"nul\x00.html",
+	} {
+		var bundleErr *wkhtmltox.BundleError
+		if err := b.Add(name, strings.NewReader("x")); !errors.As(err, &bundleErr) {
+			t.Fatalf("expected a *BundleError for %q, got %v", name, err)
+		}
+	}
+
+	if err := b.Add("css/./site.css", strings.NewReader("x")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.Add("css/site.css", strings.NewReader("x")); err == nil {
+		t.Fatal("expected an error for a duplicate file")
+	}
+
+	archive := buildZip(t, zipEntry{name: "../../evil.sh", mode: 0755, data: "#!/bin/sh"})
+	if err := b.AddZip(bytes.NewReader(archive), int64(len(archive))); err == nil {
+		t.Fatal("expected an error for an archive escaping the bundle")
+	}
+
+	archive = buildZip(t, zipEntry{name: "link", mode: fs.ModeSymlink | 0777, data: "/etc/passwd"})
+	if err := b.AddZip(bytes.NewReader(archive), int64(len(archive))); err == nil {
+		t.Fatal("expected an error for a symbolic link")
+	}
+}
+
+func TestBundleLimits(t *testing.T) {
+	b, _ := wkhtmltox.NewBundle(t.TempDir(), wkhtmltox.BundleLimits{MaxBytes: 10, MaxFiles: 2})
+	defer b.Close()
+
+	if err := b.Add("a.html", strings.NewReader("12345")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var bundleErr *wkhtmltox.BundleError
+	if err := b.Add("b.css", strings.NewReader("123456")); !errors.As(err, &bundleErr) {
+		t.Fatalf("expected a *BundleError for too many bytes, got %v", err)
+	}
+
+	if err := b.Add("c.css", strings.NewReader("")); !errors.As(err, &bundleErr) {
+		t.Fatalf("expected a *BundleError for too many files, got %v", err)
+	}
+
+	// A small archive that inflates past the limit
+	archive := buildZip(t, zipEntry{name: "bomb.html", mode: 0644, data: strings.Repeat("a", 100000)})
+	big, _ := wkhtmltox.NewBundle(t.TempDir(), wkhtmltox.BundleLimits{MaxBytes: int64(len(archive))})
+	defer big.Close()
+	if err := big.AddZip(bytes.NewReader(archive), int64(len(archive))); !errors.As(err, &bundleErr) {
+		t.Fatalf("expected a *BundleError for an archive that inflates too far, got %v", err)
+	}
+}
+
+func TestGenerateBundle(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	b, err := wkhtmltox.NewBundle(t.TempDir(), wkhtmltox.BundleLimits{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer b.Close()
+
+	logo := filepath.Join(b.Dir(), "logo.png")
+	b.Add("index.html", strings.NewReader(`<img src="file://`+logo+`">`))
+	b.Add("logo.png", strings.NewReader("png"))
+	b.Add("evil.html", strings.NewReader(`<iframe src="file:///etc/passwd"></iframe>`))
+	output := filepath.Join(t.TempDir(), "file.pdf")
+
+	var pfs wkhtmltox.PDFFlagSet
+	if out, err := pfs.GenerateBundle(context.Background(), nil, b, "", output); err != nil {
+		t.Fatalf("expected files in the bundle to load, got %v\n%s", err, out)
+	}
+
+	pfs = make(wkhtmltox.PDFFlagSet)
+	pfs.SetLocalFileAccess(true)
+	pfs.SetAllow([]string{"/"})
+	out, err := pfs.GenerateBundle(context.Background(), nil, b, "evil.html", output)
+	if err == nil || !strings.Contains(string(out), "Blocked access to file /etc/passwd") {
+		t.Fatalf("expected /etc/passwd to be blocked, got %v\n%s", err, out)
+	}
+
+	if allow, _ := pfs.GetAllow(); len(allow) != 1 || allow[0] != "/" {
+		t.Fatalf("expected the flags to be left unchanged, got %q", allow)
+	}
+
+	var ifs wkhtmltox.ImageFlagSet
+	if _, err := ifs.GenerateBundle(context.Background(), nil, b, "evil.html", filepath.Join(t.TempDir(), "file.png")); err == nil {
+		t.Fatal("expected /etc/passwd to be blocked")
+	}
+}
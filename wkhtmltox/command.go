@@ -0,0 +1,184 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+const maskedValue = "********"
+
+// Headers whose values are masked when a Command is printed
+var secretHeaders = []string{
+	"authorization",
+	"proxy-authorization",
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Command represents a converter invocation
+type Command struct {
+	Binary string   // Name of the converter executable
+	Args   []string // Flags followed by the input and output
+}
+
+// newCommand validates the flags and positional arguments of a conversion and
+// assembles them into a Command
+func newCommand(binary string, fs flagSet, flags []string, inputURL string, outputFile string) (Command, error) {
+	if err := validateFlagSet(fs); err != nil {
+		return Command{}, err
+	}
+
+	input, err := normalizeInput(inputURL)
+	if err != nil {
+		return Command{}, err
+	}
+
+	output, err := normalizeOutput(outputFile)
+	if err != nil {
+		return Command{}, err
+	}
+
+	args := make([]string, 0, len(flags)+2)
+	args = append(args, flags...)
+	args = append(args, input, output)
+
+	return Command{Binary: binary, Args: args}, nil
+}
+
+// String returns the command as a shell-quoted string with secrets masked
+func (c Command) String() string {
+	return c.Shell(true)
+}
+
+// Shell returns the command as a string that can be pasted into a POSIX
+// shell. Passwords and authentication headers are masked when mask is true.
+func (c Command) Shell(mask bool) string {
+	args := c.Args
+	if mask {
+		args = maskArgs(args)
+	}
+
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, shellQuote(c.Binary))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func maskArgs(args []string) []string {
+	masked := append([]string(nil), args...)
+
+	for i := 0; i < len(masked); i++ {
+		switch masked[i] {
+		case "--password":
+			if i+1 < len(masked) {
+				masked[i+1] = maskedValue
+			}
+			i++
+		case "--custom-header":
+			if i+2 < len(masked) && checkStringSliceContains(secretHeaders, strings.ToLower(masked[i+1])) {
+				masked[i+2] = maskedValue
+			}
+			i += 2
+		case "--cookie":
+			i += 2
+		}
+	}
+
+	return masked
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	if shellSafe.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func dryRun(cmd Command, err error, logger *log.Logger) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Print(cmd.String())
+
+	return []byte(cmd.String() + "\n"), nil
+}
+
+// Command returns the image conversion command without running it. Local
+// paths are made absolute, and an error is returned if inputURL, outputFile or
+// any flag value could be read by the converter as a flag.
+func (ifs *ImageFlagSet) Command(inputURL string, outputFile string) (Command, error) {
+	return newCommand(imageConverterBinary, flagSet(*ifs), ifs.Flags(), inputURL, outputFile)
+}
+
+// DryRun logs the image conversion command, with secrets masked, instead of
+// running it. The log line is also returned in place of the converter output.
+// A nil logger uses the standard logger.
+func (ifs *ImageFlagSet) DryRun(inputURL string, outputFile string, logger *log.Logger) ([]byte, error) {
+	cmd, err := ifs.Command(inputURL, outputFile)
+
+	return dryRun(cmd, err, logger)
+}
+
+// Command returns the PDF conversion command without running it. Local
+// paths are made absolute, and an error is returned if inputURL, outputFile or
+// any flag value could be read by the converter as a flag.
+func (pfs *PDFFlagSet) Command(inputURL string, outputFile string) (Command, error) {
+	return newCommand(pdfConverterBinary, flagSet(*pfs), pfs.Flags(), inputURL, outputFile)
+}
+
+// DryRun logs the PDF conversion command, with secrets masked, instead of
+// running it. The log line is also returned in place of the converter output.
+// A nil logger uses the standard logger.
+func (pfs *PDFFlagSet) DryRun(inputURL string, outputFile string, logger *log.Logger) ([]byte, error) {
+	cmd, err := pfs.Command(inputURL, outputFile)
+
+	return dryRun(cmd, err, logger)
+}
+
+// Command returns the command the Job runs
+func (j Job) Command() (Command, error) {
+	binary, err := j.kind.Binary()
+	if err != nil {
+		return Command{}, err
+	}
+
+	return newCommand(binary, j.flags, j.Flags(), j.input, j.output)
+}
+
+// DryRun logs the command the Job runs, with secrets masked, instead of
+// running it
+func (j Job) DryRun(logger *log.Logger) ([]byte, error) {
+	cmd, err := j.Command()
+
+	return dryRun(cmd, err, logger)
+}
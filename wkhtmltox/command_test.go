@@ -0,0 +1,108 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+func TestPDFFlagSetCommand(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetTitle("Q1 Report")
+	pfs.SetPageSize("A4")
+	cmd, err := pfs.Command("http://example.com/?a=1&b=2", "/tmp/file.pdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cmd.Binary != "wkhtmltopdf" {
+		t.Fatalf("expected binary '%s' but got '%s'", "wkhtmltopdf", cmd.Binary)
+	}
+
+	expected := []string{"--page-size", "A4", "--title", "Q1 Report", "http://example.com/?a=1&b=2", "/tmp/file.pdf"}
+	if !reflect.DeepEqual(expected, cmd.Args) {
+		t.Fatalf("expected '%s' but got '%s'", expected, cmd.Args)
+	}
+
+	expectedShell := `wkhtmltopdf --page-size A4 --title 'Q1 Report' 'http://example.com/?a=1&b=2' /tmp/file.pdf`
+	if cmd.String() != expectedShell {
+		t.Fatalf("expected '%s' but got '%s'", expectedShell, cmd.String())
+	}
+}
+
+func TestCommandShellQuotesSingleQuotes(t *testing.T) {
+	cmd := wkhtmltox.Command{Binary: "wkhtmltopdf", Args: []string{"--title", "King'ori's", "", "in", "out"}}
+
+	expected := `wkhtmltopdf --title 'King'\''ori'\''s' '' in out`
+	if cmd.String() != expected {
+		t.Fatalf("expected '%s' but got '%s'", expected, cmd.String())
+	}
+}
+
+func TestImageFlagSetCommandMasksSecrets(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs.SetPassword("hunter2")
+	ifs.SetCustomHeader([]wkhtmltox.HeaderSet{
+		{Name: "Authorization", Value: "Bearer abc"},
+		{Name: "Accept", Value: "text/html"},
+	})
+	cmd, err := ifs.Command("http://example.com", "/tmp/file.png")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	masked := cmd.String()
+	if strings.Contains(masked, "hunter2") || strings.Contains(masked, "Bearer abc") {
+		t.Fatalf("expected secrets to be masked, got '%s'", masked)
+	}
+
+	if !strings.Contains(masked, "text/html") {
+		t.Fatalf("expected non-secret headers to be kept, got '%s'", masked)
+	}
+
+	unmasked := cmd.Shell(false)
+	if !strings.Contains(unmasked, "hunter2") || !strings.Contains(unmasked, "'Bearer abc'") {
+		t.Fatalf("expected secrets to be shown, got '%s'", unmasked)
+	}
+
+	if !reflect.DeepEqual(cmd.Args[len(cmd.Args)-2:], []string{"http://example.com", "/tmp/file.png"}) {
+		t.Fatalf("expected masking not to modify the arguments, got '%s'", cmd.Args)
+	}
+}
+
+func TestPDFFlagSetDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetPassword("hunter2")
+
+	out, err := pfs.DryRun("http://example.com", "/tmp/file.pdf", log.New(&buf, "", 0))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := "wkhtmltopdf --password '********' http://example.com /tmp/file.pdf\n"
+	if buf.String() != expected || string(out) != expected {
+		t.Fatalf("expected '%s' to be logged and returned, got '%s' and '%s'", expected, buf.String(), out)
+	}
+}
@@ -18,12 +18,100 @@
 package wkhtmltox
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"io"
+	"reflect"
+	"sort"
 )
 
 type flagSet map[string]interface{}
 
+// FlagTypeError is returned when a flag holds a value of an unexpected type
+type FlagTypeError struct {
+	Key      string // Flag key that was looked up
+	Expected string // Type that was asked for
+	Actual   string // Type that is actually stored
+}
+
+func (e *FlagTypeError) Error() string {
+	return fmt.Sprintf("wkhtmltox: flag %q holds %s, not %s", e.Key, e.Actual, e.Expected)
+}
+
+// Get retrieves the value of a flag from an ImageFlagSet or PDFFlagSet. It
+// returns the zero value and false when the flag is absent, and a
+// *FlagTypeError when the flag holds something other than T.
+func Get[T any, F ~map[string]interface{}](fs F, key string) (T, bool, error) {
+	var zero T
+
+	raw, exists := fs[key]
+	if !exists {
+		return zero, false, nil
+	}
+
+	value, ok := raw.(T)
+	if !ok {
+		return zero, true, &FlagTypeError{
+			Key:      key,
+			Expected: reflect.TypeOf(&zero).Elem().String(),
+			Actual:   fmt.Sprintf("%T", raw),
+		}
+	}
+
+	return value, true, nil
+}
+
+// getFlag backs the typed Get* accessors, which only report whether a usable
+// value is present.
+func getFlag[T any, F ~map[string]interface{}](fs F, key string) (T, bool) {
+	value, exists, err := Get[T](fs, key)
+
+	return value, exists && err == nil
+}
+
+func cloneFlagValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []CookieSet:
+		return append([]CookieSet(nil), v...)
+	case []HeaderSet:
+		return append([]HeaderSet(nil), v...)
+	case interface{ clone() interface{} }:
+		return v.clone()
+	}
+
+	return value
+}
+
+func cloneFlagSet[F ~map[string]interface{}](fs F) F {
+	if fs == nil {
+		return nil
+	}
+
+	clone := make(F, len(fs))
+	for key, value := range fs {
+		clone[key] = cloneFlagValue(value)
+	}
+
+	return clone
+}
+
+func equalFlagSets[F ~map[string]interface{}](a, b F) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, av := range a {
+		bv, exists := b[key]
+		if !exists || !reflect.DeepEqual(av, bv) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // CookieSet represents cookie name and value
 type CookieSet struct {
 	Name  string `json:"name,omitempty"`
@@ -98,19 +186,26 @@ func evaluateBoolType3Flag(flags *[]string, flagKey string, flagValue bool) {
 	}
 }
 
-func runConversionCommand(binary string, params []string, inputURL *string, outputFile *string) ([]byte, error) {
-	var out []byte
+// runConversionInput runs a conversion whose input, if it is "-", is read
+// from stdin
+func runConversionInput(ctx context.Context, ex Executor, c Command, stdin io.Reader) ([]byte, error) {
+	if ex == nil {
+		ex = DefaultExecutor
+	}
+
+	// No shell is involved, so arguments need no escaping. What matters is
+	// that no value is mistaken for a flag, which newCommand has checked.
+	out, err := ex.Execute(ctx, Execution{Binary: c.Binary, Args: c.Args, Stdin: stdin})
 
-	// I'm uncertain if we need to escape parameters ... can't seem to find
-	// anything conclusive yet, but so far this seems to be the best find:
-	// https://stackoverflow.com/a/8025343/2184155
+	return out.Combined, err
+}
 
-	params = append(params, *inputURL, *outputFile)
-	cmd := exec.Command(binary, params...)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return out, err
+func sortedFlagKeys(fs flagSet) []string {
+	keys := make([]string, 0, len(fs))
+	for key := range fs {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	return out, err
+	return keys
 }
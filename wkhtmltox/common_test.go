@@ -16,3 +16,46 @@
 // along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
 
 package wkhtmltox
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	ifs := make(ImageFlagSet)
+	ifs["width"] = 640
+
+	width, exists, err := Get[int](ifs, "width")
+	if err != nil || !exists || width != 640 {
+		t.Fatalf("expected %s to be %d, got %d (exists: %t, err: %v)", "width", 640, width, exists, err)
+	}
+}
+
+func TestGetWhenAbsent(t *testing.T) {
+	pfs := make(PDFFlagSet)
+
+	title, exists, err := Get[string](pfs, "title")
+	if err != nil || exists || title != "" {
+		t.Fatalf("expected %s to be absent, got %q (exists: %t, err: %v)", "title", title, exists, err)
+	}
+}
+
+func TestGetWhenWrongType(t *testing.T) {
+	pfs := make(PDFFlagSet)
+	pfs["dpi"] = "300"
+
+	dpi, exists, err := Get[int](pfs, "dpi")
+	if !exists || dpi != 0 {
+		t.Fatalf("expected %s to exist with zero value, got %d (exists: %t)", "dpi", dpi, exists)
+	}
+
+	var typeErr *FlagTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected a FlagTypeError, got %v", err)
+	}
+
+	if typeErr.Key != "dpi" || typeErr.Expected != "int" || typeErr.Actual != "string" {
+		t.Fatalf("unexpected FlagTypeError %+v", typeErr)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// CompatibilityPolicy decides what a Converter does with flags that the
+// installed converter would reject or silently ignore
+type CompatibilityPolicy int
+
+const (
+	// PassThrough emits every flag regardless of support
+	PassThrough CompatibilityPolicy = iota
+
+	// WarnAndDrop logs a warning and leaves unsupported flags out
+	WarnAndDrop
+
+	// RejectIncompatible fails with an *IncompatibleFlagError
+	RejectIncompatible
+)
+
+// Minimum requirements of flags that not every converter supports
+type flagRequirement struct {
+	major, minor, patch int
+	patchedQt           bool
+}
+
+var flagRequirements = map[string]flagRequirement{
+	"disable-external-links":    {patchedQt: true},
+	"disable-internal-links":    {patchedQt: true},
+	"disable-smart-shrinking":   {patchedQt: true},
+	"enable-external-links":     {patchedQt: true},
+	"enable-internal-links":     {patchedQt: true},
+	"enable-smart-shrinking":    {patchedQt: true},
+	"load-media-error-handling": {major: 0, minor: 12, patch: 1},
+	"use-xserver":               {patchedQt: true},
+}
+
+// IncompatibleFlagError is returned when the installed converter does not
+// support a flag
+type IncompatibleFlagError struct {
+	Flag        string // Flag as it would be passed, e.g. "--disable-smart-shrinking"
+	Requirement string // What the flag needs, e.g. "wkhtmltopdf 0.12.1 or later"
+	Version     string // Version of the installed converter
+}
+
+func (e *IncompatibleFlagError) Error() string {
+	return fmt.Sprintf("wkhtmltox: %s needs %s, have %q", e.Flag, e.Requirement, e.Version)
+}
+
+// Converter runs conversions with an installed converter, adapting flags to
+// what its version supports
+type Converter struct {
+	Kind     ConverterKind       // Which converter this is
+	Info     ConverterInfo       // Installed converter, see LookupConverterInfo
+	Policy   CompatibilityPolicy // What to do with unsupported flags
+	Executor Executor            // How to run the converter, nil for DefaultExecutor
+	Logger   *log.Logger         // Where warnings go, nil for the standard logger
+
+	// BlankThreshold is the share of an image, between 0 and 1, that may be
+	// the background color before the image is reported as blank. Zero skips
+	// the check.
+	BlankThreshold float64
+}
+
+// NewConverter looks up the installed converter of the given kind
+func NewConverter(kind ConverterKind, policy CompatibilityPolicy) (*Converter, error) {
+	binary, err := kind.Binary()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := LookupConverterInfo(binary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Converter{Kind: kind, Info: info, Policy: policy}, nil
+}
+
+func (c *Converter) checkFlag(flag string) *IncompatibleFlagError {
+	binary, _ := c.Kind.Binary()
+	incompatible := func(requirement string) *IncompatibleFlagError {
+		return &IncompatibleFlagError{Flag: "--" + flag, Requirement: requirement, Version: c.Info.Version}
+	}
+
+	if req, known := flagRequirements[flag]; known {
+		var needs []string
+		if c.Info.Compare(req.major, req.minor, req.patch) < 0 {
+			needs = append(needs, fmt.Sprintf("%s %d.%d.%d or later", binary, req.major, req.minor, req.patch))
+		}
+		if req.patchedQt && !c.Info.PatchedQt {
+			needs = append(needs, binary+" with patched Qt")
+		}
+		if len(needs) > 0 {
+			return incompatible(strings.Join(needs, " and "))
+		}
+	}
+
+	// Only trust --extended-help when it was read
+	if len(c.Info.flags) > 0 && !c.Info.Supports(flag) {
+		if _, listed := c.Info.flags[flag]; listed {
+			return incompatible(binary + " with patched Qt")
+		}
+		return incompatible("a " + binary + " that lists it in --extended-help")
+	}
+
+	return nil
+}
+
+// flags generates the flags of fs that the converter supports, following the
+// compatibility policy
+func (c *Converter) flags(fs flagSet, kind ConverterKind) ([]string, error) {
+	if kind != c.Kind {
+		return nil, fmt.Errorf("wkhtmltox: cannot run %s flags with the %s converter", kind, c.Kind)
+	}
+
+	var flags []string
+	for _, key := range sortedFlagKeys(fs) {
+		single := flagSet{key: fs[key]}
+
+		var args []string
+		if kind == ImageConverter {
+			ifs := ImageFlagSet(single)
+			args = ifs.Flags()
+		} else {
+			pfs := PDFFlagSet(single)
+			args = pfs.Flags()
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if c.Policy != PassThrough {
+			if err := c.checkFlag(strings.TrimPrefix(args[0], "--")); err != nil {
+				if c.Policy == RejectIncompatible {
+					return nil, err
+				}
+				c.warnf("dropping %s: needs %s", err.Flag, err.Requirement)
+				continue
+			}
+		}
+
+		flags = append(flags, args...)
+	}
+
+	return flags, nil
+}
+
+func (c *Converter) warnf(format string, args ...interface{}) {
+	logger := c.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("wkhtmltox: "+format, args...)
+}
+
+func (c *Converter) command(fs flagSet, kind ConverterKind, inputURL string, outputFile string) (Command, error) {
+	flags, err := c.flags(fs, kind)
+	if err != nil {
+		return Command{}, err
+	}
+
+	binary := c.Info.Path
+	if binary == "" {
+		if binary, err = c.Kind.Binary(); err != nil {
+			return Command{}, err
+		}
+	}
+
+	return newCommand(binary, fs, flags, inputURL, outputFile)
+}
+
+// ImageCommand returns the command that converts inputURL to an image
+func (c *Converter) ImageCommand(ifs ImageFlagSet, inputURL string, outputFile string) (Command, error) {
+	return c.command(flagSet(ifs), ImageConverter, inputURL, outputFile)
+}
+
+// PDFCommand returns the command that converts inputURL to a PDF
+func (c *Converter) PDFCommand(pfs PDFFlagSet, inputURL string, outputFile string) (Command, error) {
+	return c.command(flagSet(pfs), PDFConverter, inputURL, outputFile)
+}
+
+func (c *Converter) outputCheck(kind ConverterKind, fs flagSet) outputCheck {
+	check := newOutputCheck(kind, fs)
+	if kind == ImageConverter {
+		check.blankThreshold = c.BlankThreshold
+	}
+
+	return check
+}
+
+// GenerateImage performs the image conversion and saves the file to disk
+func (c *Converter) GenerateImage(ctx context.Context, ifs ImageFlagSet, inputURL string, outputFile string) ([]byte, error) {
+	return generateFile(ctx, c.Executor, c.outputCheck(ImageConverter, flagSet(ifs)), URLSource{URL: inputURL}, outputFile, func(inputURL string, outputFile string) (Command, error) {
+		return c.ImageCommand(ifs, inputURL, outputFile)
+	})
+}
+
+// GeneratePDF performs the PDF conversion and saves the file to disk
+func (c *Converter) GeneratePDF(ctx context.Context, pfs PDFFlagSet, inputURL string, outputFile string) ([]byte, error) {
+	return generateFile(ctx, c.Executor, c.outputCheck(PDFConverter, flagSet(pfs)), URLSource{URL: inputURL}, outputFile, func(inputURL string, outputFile string) (Command, error) {
+		return c.PDFCommand(pfs, inputURL, outputFile)
+	})
+}
+
+// GenerateJob performs the conversion described by a Job of the same kind
+func (c *Converter) GenerateJob(ctx context.Context, j Job) ([]byte, error) {
+	return generateFile(ctx, c.Executor, c.outputCheck(j.kind, j.flags), URLSource{URL: j.input}, j.output, func(inputURL string, outputFile string) (Command, error) {
+		return c.command(j.flags, j.kind, inputURL, outputFile)
+	})
+}
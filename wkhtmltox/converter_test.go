@@ -0,0 +1,160 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func newTestConverter(t *testing.T, version string, policy wkhtmltox.CompatibilityPolicy) (*wkhtmltox.Converter, *wkhtmltoxtest.Executor, *bytes.Buffer) {
+	info, err := wkhtmltox.ParseConverterVersion(version)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	c := &wkhtmltox.Converter{
+		Kind:     wkhtmltox.PDFConverter,
+		Info:     info,
+		Policy:   policy,
+		Executor: ex,
+		Logger:   log.New(&buf, "", 0),
+	}
+
+	return c, ex, &buf
+}
+
+func unpatchedPDFFlagSet() wkhtmltox.PDFFlagSet {
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetGrayscale(true)
+	pfs.SetSmartShrinking(false)
+	pfs.SetLoadMediaErrorHandling("ignore")
+
+	return pfs
+}
+
+func TestConverterRejectIncompatible(t *testing.T) {
+	c, ex, _ := newTestConverter(t, "wkhtmltopdf 0.12.0", wkhtmltox.RejectIncompatible)
+
+	_, err := c.GeneratePDF(context.Background(), unpatchedPDFFlagSet(), "http://example.com", "/tmp/file.pdf")
+
+	var incompatible *wkhtmltox.IncompatibleFlagError
+	if !errors.As(err, &incompatible) {
+		t.Fatalf("expected an IncompatibleFlagError, got %v", err)
+	}
+
+	if incompatible.Flag != "--load-media-error-handling" || incompatible.Requirement != "wkhtmltopdf 0.12.1 or later" {
+		t.Fatalf("unexpected error %v", incompatible)
+	}
+
+	if len(ex.Calls()) != 0 {
+		t.Fatal("expected the converter not to run")
+	}
+}
+
+func TestConverterRejectIncompatibleFlags(t *testing.T) {
+	c, _, _ := newTestConverter(t, "wkhtmltopdf 0.12.0", wkhtmltox.RejectIncompatible)
+
+	for flag, set := range map[string]func(pfs wkhtmltox.PDFFlagSet){
+		"--disable-external-links":    func(pfs wkhtmltox.PDFFlagSet) { pfs.SetExternalLinks(false) },
+		"--enable-external-links":     func(pfs wkhtmltox.PDFFlagSet) { pfs.SetExternalLinks(true) },
+		"--disable-internal-links":    func(pfs wkhtmltox.PDFFlagSet) { pfs.SetInternalLinks(false) },
+		"--enable-internal-links":     func(pfs wkhtmltox.PDFFlagSet) { pfs.SetInternalLinks(true) },
+		"--disable-smart-shrinking":   func(pfs wkhtmltox.PDFFlagSet) { pfs.SetSmartShrinking(false) },
+		"--enable-smart-shrinking":    func(pfs wkhtmltox.PDFFlagSet) { pfs.SetSmartShrinking(true) },
+		"--load-media-error-handling": func(pfs wkhtmltox.PDFFlagSet) { pfs.SetLoadMediaErrorHandling("ignore") },
+		"--use-xserver":               func(pfs wkhtmltox.PDFFlagSet) { pfs.SetUseXServer(true) },
+	} {
+		pfs := make(wkhtmltox.PDFFlagSet)
+		set(pfs)
+
+		_, err := c.PDFCommand(pfs, "http://example.com", "/tmp/file.pdf")
+		var incompatible *wkhtmltox.IncompatibleFlagError
+		if !errors.As(err, &incompatible) || incompatible.Flag != flag {
+			t.Fatalf("expected %s to be rejected, got %v", flag, err)
+		}
+	}
+}
+
+func TestConverterWarnAndDrop(t *testing.T) {
+	c, ex, logs := newTestConverter(t, "wkhtmltopdf 0.12.5", wkhtmltox.WarnAndDrop)
+
+	target := filepath.Join(t.TempDir(), "file.pdf")
+	if _, err := c.GeneratePDF(context.Background(), unpatchedPDFFlagSet(), "http://example.com", target); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []string{"--grayscale", "--load-media-error-handling", "ignore", "http://example.com"}
+	if got := ex.Calls()[0].Args; !reflect.DeepEqual(expected, got[:len(got)-1]) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
+	if !strings.Contains(logs.String(), "dropping --disable-smart-shrinking: needs wkhtmltopdf with patched Qt") {
+		t.Fatalf("expected a warning, got '%s'", logs)
+	}
+}
+
+func TestConverterPassThrough(t *testing.T) {
+	c, _, _ := newTestConverter(t, "wkhtmltopdf 0.12.0", wkhtmltox.PassThrough)
+
+	cmd, err := c.PDFCommand(unpatchedPDFFlagSet(), "http://example.com", "/tmp/file.pdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(cmd.Args) != 6 || cmd.Binary != "wkhtmltopdf" {
+		t.Fatalf("expected every flag to be passed through, got '%s'", cmd)
+	}
+}
+
+func TestConverterKindMismatch(t *testing.T) {
+	c, _, _ := newTestConverter(t, "wkhtmltopdf 0.12.6 (with patched qt)", wkhtmltox.PassThrough)
+
+	if _, err := c.GenerateImage(context.Background(), make(wkhtmltox.ImageFlagSet), "http://example.com", "/tmp/file.png"); err == nil {
+		t.Fatal("expected image flags to be rejected by a PDF converter")
+	}
+}
+
+func TestNewConverterUsesExtendedHelp(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+
+	c, err := wkhtmltox.NewConverter(wkhtmltox.ImageConverter, wkhtmltox.RejectIncompatible)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs["no-such-flag"] = "value"
+	_, err = c.ImageCommand(ifs, "http://example.com", "/tmp/file.png")
+
+	var incompatible *wkhtmltox.IncompatibleFlagError
+	if !errors.As(err, &incompatible) || !strings.Contains(incompatible.Requirement, "--extended-help") {
+		t.Fatalf("expected an unlisted flag to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const downloadsURL = "https://wkhtmltopdf.org/downloads.html"
+
+// CheckStatus is the outcome of a single Diagnose check
+type CheckStatus string
+
+const (
+	// CheckOK means nothing needs doing
+	CheckOK CheckStatus = "ok"
+
+	// CheckWarning means conversions work but may not render as expected
+	CheckWarning CheckStatus = "warning"
+
+	// CheckError means conversions will fail
+	CheckError CheckStatus = "error"
+)
+
+// Check is the result of a single Diagnose check
+type Check struct {
+	Name   string      `json:"name"`             // What was checked
+	Status CheckStatus `json:"status"`           // Outcome
+	Detail string      `json:"detail,omitempty"` // What was found
+	Fix    string      `json:"fix,omitempty"`    // Suggested fix, unless the check passed
+}
+
+// Diagnosis is the report produced by Diagnose
+type Diagnosis struct {
+	Checks []Check `json:"checks"`
+}
+
+// OK reports whether no check failed with an error
+func (d Diagnosis) OK() bool {
+	for _, c := range d.Checks {
+		if c.Status == CheckError {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WriteText writes the report in a human readable form
+func (d Diagnosis) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+
+	for _, c := range d.Checks {
+		fmt.Fprintf(&buf, "[%s] %s", strings.ToUpper(string(c.Status)), c.Name)
+		if c.Detail != "" {
+			fmt.Fprintf(&buf, ": %s", c.Detail)
+		}
+		buf.WriteString("\n")
+		if c.Fix != "" {
+			fmt.Fprintf(&buf, "    fix: %s\n", c.Fix)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// Diagnose checks that the converters are installed and able to render: their
+// versions and Qt builds, a trivial conversion with each, installed fonts, the
+// display and the locale
+func Diagnose(ctx context.Context) Diagnosis {
+	var d Diagnosis
+	needsDisplay := false
+
+	for _, kind := range []ConverterKind{PDFConverter, ImageConverter} {
+		binary, _ := kind.Binary()
+
+		info, err := LookupConverterInfo(binary)
+		if err != nil {
+			d.Checks = append(d.Checks, Check{
+				Name:   binary,
+				Status: CheckError,
+				Detail: err.Error(),
+				Fix:    "install wkhtmltox from " + downloadsURL + " and make sure " + binary + " is on PATH",
+			})
+			continue
+		}
+
+		d.Checks = append(d.Checks, Check{Name: binary, Status: CheckOK, Detail: fmt.Sprintf("%s (%s)", info.Version, info.Path)})
+		d.Checks = append(d.Checks, diagnosePatchedQt(binary, info))
+		d.Checks = append(d.Checks, diagnoseRender(ctx, &Converter{Kind: kind, Info: info}))
+
+		if !info.PatchedQt {
+			needsDisplay = true
+		}
+	}
+
+	d.Checks = append(d.Checks, diagnoseFonts(ctx))
+	d.Checks = append(d.Checks, diagnoseDisplay(needsDisplay))
+	d.Checks = append(d.Checks, diagnoseLocale())
+
+	return d
+}
+
+func diagnosePatchedQt(binary string, info ConverterInfo) Check {
+	check := Check{Name: binary + " patched Qt", Status: CheckOK, Detail: "yes"}
+
+	if !info.PatchedQt {
+		check.Status = CheckWarning
+		check.Detail = "no, headers, footers, outlines, tables of contents and disabling smart shrinking are unavailable"
+		check.Fix = "install the build with patched Qt from " + downloadsURL
+	}
+
+	return check
+}
+
+func diagnoseRender(ctx context.Context, c *Converter) Check {
+	binary, _ := c.Kind.Binary()
+	check := Check{Name: binary + " render", Status: CheckError}
+
+	dir, err := os.MkdirTemp("", "wkhtml-doctor")
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(input, []byte("<html><body><p>wkhtml doctor</p></body></html>"), 0644); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	var out []byte
+	output := filepath.Join(dir, "output")
+	if c.Kind == ImageConverter {
+		output += ".png"
+		out, err = c.GenerateImage(ctx, make(ImageFlagSet), input, output)
+	} else {
+		output += ".pdf"
+		out, err = c.GeneratePDF(ctx, make(PDFFlagSet), input, output)
+	}
+
+	if err != nil {
+		check.Detail = fmt.Sprintf("%v: %s", err, strings.TrimSpace(string(out)))
+		check.Fix = "run " + binary + " by hand on a simple page and check the fonts and display checks below"
+		return check
+	}
+
+	if stat, err := os.Stat(output); err != nil || stat.Size() == 0 {
+		check.Detail = "converter exited successfully but wrote no output"
+		check.Fix = "check that the temporary directory is writable"
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = "rendered a test page"
+
+	return check
+}
+
+func diagnoseFonts(ctx context.Context) Check {
+	check := Check{Name: "fonts", Status: CheckWarning}
+
+	path, err := exec.LookPath("fc-list")
+	if err != nil {
+		check.Detail = "fontconfig is not installed, fonts may be missing"
+		check.Fix = "install fontconfig and a font package such as fonts-dejavu-core"
+		return check
+	}
+
+	out, err := exec.CommandContext(ctx, path).Output()
+	if err != nil {
+		check.Detail = "fc-list failed: " + err.Error()
+		check.Fix = "check the fontconfig installation"
+		return check
+	}
+
+	// fc-list prints one font per line
+	count := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	if count == 0 {
+		check.Status = CheckError
+		check.Detail = "no fonts installed, text will not render"
+		check.Fix = "install a font package such as fonts-dejavu-core or fonts-liberation"
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = fmt.Sprintf("%d fonts installed", count)
+
+	return check
+}
+
+func diagnoseDisplay(needsDisplay bool) Check {
+	display := os.Getenv("DISPLAY")
+	platform := os.Getenv("QT_QPA_PLATFORM")
+	check := Check{Name: "display", Status: CheckOK, Detail: fmt.Sprintf("DISPLAY=%q QT_QPA_PLATFORM=%q", display, platform)}
+
+	if needsDisplay && display == "" && platform != "offscreen" {
+		check.Status = CheckError
+		check.Detail += ", converters without patched Qt need an X server"
+		check.Fix = "run under xvfb-run, set QT_QPA_PLATFORM=offscreen, or install the build with patched Qt"
+	}
+
+	return check
+}
+
+func diagnoseLocale() Check {
+	locale := os.Getenv("LC_ALL")
+	if locale == "" {
+		locale = os.Getenv("LANG")
+	}
+	check := Check{Name: "locale", Status: CheckOK, Detail: locale}
+
+	normalized := strings.ToLower(strings.Replace(locale, "-", "", -1))
+	if !strings.Contains(normalized, "utf8") {
+		check.Status = CheckWarning
+		check.Detail = fmt.Sprintf("%q is not a UTF-8 locale, non-ASCII text may be garbled", locale)
+		check.Fix = "set LANG=C.UTF-8 or another UTF-8 locale"
+	}
+
+	return check
+}
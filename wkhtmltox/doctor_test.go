@@ -0,0 +1,109 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func findCheck(d wkhtmltox.Diagnosis, name string) wkhtmltox.Check {
+	for _, c := range d.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return wkhtmltox.Check{}
+}
+
+func TestDiagnose(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	t.Setenv("LANG", "C.UTF-8")
+
+	d := wkhtmltox.Diagnose(context.Background())
+
+	for _, name := range []string{"wkhtmltopdf", "wkhtmltopdf patched Qt", "wkhtmltopdf render", "wkhtmltoimage render", "display", "locale"} {
+		if c := findCheck(d, name); c.Status != wkhtmltox.CheckOK {
+			t.Fatalf("expected check %s to pass, got %+v", name, c)
+		}
+	}
+}
+
+func TestDiagnoseUnpatchedQtWithoutDisplay(t *testing.T) {
+	f := wkhtmltoxtest.InstallFakeConverters(t)
+	f.SetVersion(t, "0.12.5")
+	t.Setenv("DISPLAY", "")
+	t.Setenv("QT_QPA_PLATFORM", "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LANG", "C")
+
+	d := wkhtmltox.Diagnose(context.Background())
+
+	if c := findCheck(d, "wkhtmltoimage patched Qt"); c.Status != wkhtmltox.CheckWarning || c.Fix == "" {
+		t.Fatalf("expected a patched Qt warning with a fix, got %+v", c)
+	}
+
+	if c := findCheck(d, "display"); c.Status != wkhtmltox.CheckError || !strings.Contains(c.Fix, "QT_QPA_PLATFORM=offscreen") {
+		t.Fatalf("expected a display error with a fix, got %+v", c)
+	}
+
+	if c := findCheck(d, "locale"); c.Status != wkhtmltox.CheckWarning {
+		t.Fatalf("expected a locale warning, got %+v", c)
+	}
+
+	if d.OK() {
+		t.Fatal("expected the diagnosis to fail")
+	}
+}
+
+func TestDiagnoseMissingConverters(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	d := wkhtmltox.Diagnose(context.Background())
+
+	if c := findCheck(d, "wkhtmltopdf"); c.Status != wkhtmltox.CheckError || !strings.Contains(c.Fix, "install wkhtmltox") {
+		t.Fatalf("expected a missing converter error, got %+v", c)
+	}
+}
+
+func TestDiagnosisReport(t *testing.T) {
+	d := wkhtmltox.Diagnosis{Checks: []wkhtmltox.Check{
+		{Name: "wkhtmltopdf", Status: wkhtmltox.CheckOK, Detail: "wkhtmltopdf 0.12.6"},
+		{Name: "locale", Status: wkhtmltox.CheckWarning, Detail: "C", Fix: "set LANG=C.UTF-8"},
+	}}
+
+	var buf bytes.Buffer
+	d.WriteText(&buf)
+	expected := "[OK] wkhtmltopdf: wkhtmltopdf 0.12.6\n[WARNING] locale: C\n    fix: set LANG=C.UTF-8\n"
+	if buf.String() != expected {
+		t.Fatalf("expected '%s' but got '%s'", expected, buf.String())
+	}
+
+	data, _ := json.Marshal(d)
+	expectedJSON := `{"checks":[{"name":"wkhtmltopdf","status":"ok","detail":"wkhtmltopdf 0.12.6"},{"name":"locale","status":"warning","detail":"C","fix":"set LANG=C.UTF-8"}]}`
+	if string(data) != expectedJSON {
+		t.Fatalf("expected '%s' but got '%s'", expectedJSON, data)
+	}
+}
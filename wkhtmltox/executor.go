@@ -0,0 +1,146 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Execution represents a single run of a converter binary
+type Execution struct {
+	Binary string    // Name or path of the converter executable
+	Args   []string  // Arguments, excluding the binary
+	Stdin  io.Reader // Standard input, or nil for none
+	Env    []string  // Variables added to the current environment
+	Stderr io.Writer // Also receives standard error as it is written, if set
+}
+
+// Output represents what a converter wrote while running
+type Output struct {
+	Stdout   []byte // Standard output
+	Stderr   []byte // Standard error
+	Combined []byte // Standard output and error, interleaved as written
+}
+
+// Warnings returns the warnings the converter printed to standard error
+func (o Output) Warnings() []string {
+	return ParseWarnings(o.Stderr)
+}
+
+// ParseWarnings extracts warnings, such as "Failed to load ... (ignore)", from
+// converter output like that returned by Generate
+func ParseWarnings(out []byte) []string {
+	var warnings []string
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Warning:") {
+			warnings = append(warnings, strings.TrimSpace(strings.TrimPrefix(line, "Warning:")))
+		}
+	}
+
+	return warnings
+}
+
+// Executor runs converter binaries. Implementations must return an
+// *ExitError when the binary exits with a non-zero status.
+type Executor interface {
+	Execute(ctx context.Context, e Execution) (Output, error)
+}
+
+// ExitError is returned when a converter exits with a non-zero status
+type ExitError struct {
+	Binary string // Converter that failed
+	Code   int    // Exit status
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("wkhtmltox: %s exited with status %d", e.Binary, e.Code)
+}
+
+// ExecExecutor runs converter binaries using os/exec
+type ExecExecutor struct{}
+
+// DefaultExecutor is used when no Executor is given
+var DefaultExecutor Executor = ExecExecutor{}
+
+// Execute runs the binary and waits for it to exit. The process is killed if
+// ctx is done first, in which case the context's error is returned.
+func (ExecExecutor) Execute(ctx context.Context, e Execution) (Output, error) {
+	var stdout, stderr bytes.Buffer
+	combined := &lockedBuffer{}
+
+	cmd := exec.CommandContext(ctx, e.Binary, e.Args...)
+	cmd.Stdin = e.Stdin
+	cmd.Stdout = io.MultiWriter(&stdout, combined)
+	cmd.Stderr = io.MultiWriter(&stderr, combined)
+	if e.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, combined, e.Stderr)
+	}
+	if len(e.Env) > 0 {
+		cmd.Env = append(os.Environ(), e.Env...)
+	}
+
+	err := cmd.Run()
+	out := Output{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		Combined: combined.Bytes(),
+	}
+
+	// A deadline that passes after the converter has exited does not turn a
+	// successful conversion into a failure
+	if err != nil && ctx.Err() != nil {
+		return out, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out, &ExitError{Binary: e.Binary, Code: exitErr.ExitCode()}
+	}
+
+	return out, err
+}
+
+// lockedBuffer lets standard output and error be interleaved into one buffer
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Bytes()
+}
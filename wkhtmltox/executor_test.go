@@ -0,0 +1,138 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestExecExecutor(t *testing.T) {
+	var progress bytes.Buffer
+	exe := wkhtmltox.Execution{
+		Binary: "sh",
+		Args:   []string{"-c", `cat; echo "$GREETING" >&2; exit 3`},
+		Stdin:  strings.NewReader("out\n"),
+		Env:    []string{"GREETING=err"},
+		Stderr: &progress,
+	}
+
+	out, err := wkhtmltox.ExecExecutor{}.Execute(context.Background(), exe)
+
+	var exitErr *wkhtmltox.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+
+	if string(out.Stdout) != "out\n" || string(out.Stderr) != "err\n" || len(out.Combined) != len("out\nerr\n") {
+		t.Fatalf("unexpected output %+v", out)
+	}
+
+	if progress.String() != "err\n" {
+		t.Fatalf("expected standard error to be streamed, got %q", progress.String())
+	}
+}
+
+func TestExecExecutorContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := wkhtmltox.ExecExecutor{}.Execute(ctx, wkhtmltox.Execution{Binary: "sleep", Args: []string{"5"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+// expiredContext reports an expired deadline without ever closing Done, as a
+// context whose deadline passes just after the process exits appears
+type expiredContext struct {
+	context.Context
+}
+
+func (expiredContext) Err() error {
+	return context.DeadlineExceeded
+}
+
+func TestExecExecutorSucceedsPastDeadline(t *testing.T) {
+	out, err := wkhtmltox.ExecExecutor{}.Execute(expiredContext{context.Background()}, wkhtmltox.Execution{Binary: "echo", Args: []string{"done"}})
+	if err != nil || string(out.Stdout) != "done\n" {
+		t.Fatalf("expected the conversion to succeed, got %q (%v)", out.Stdout, err)
+	}
+}
+
+func TestPDFFlagSetGenerateContext(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Stderr: []byte("Done"), OutputFile: wkhtmltoxtest.PDF(1)})
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetGrayscale(true)
+	target := filepath.Join(t.TempDir(), "file.pdf")
+
+	out, err := pfs.GenerateContext(context.Background(), ex, "http://example.com", target)
+	if err != nil || string(out) != "Done" {
+		t.Fatalf("expected output 'Done', got %q (%v)", out, err)
+	}
+
+	calls := ex.Calls()
+	expected := []string{"--grayscale", "http://example.com"}
+	if len(calls) != 1 || calls[0].Binary != "wkhtmltopdf" || !reflect.DeepEqual(calls[0].Args[:2], expected) {
+		t.Fatalf("expected '%s' but got %+v", expected, calls)
+	}
+
+	if staged := calls[0].Args[2]; filepath.Dir(staged) != filepath.Dir(target) || filepath.Ext(staged) != ".pdf" || staged == target {
+		t.Fatalf("expected a temporary file beside %s, got %s", target, staged)
+	}
+
+	if data, _ := os.ReadFile(target); string(data) != string(wkhtmltoxtest.PDF(1)) {
+		t.Fatalf("expected the PDF at %s, got %q", target, data)
+	}
+}
+
+func TestJobGenerateContext(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{ExitCode: 1})
+	job, _ := wkhtmltox.NewImageJob("http://example.com", "/tmp/file.png", nil)
+
+	_, err := job.GenerateContext(context.Background(), ex)
+
+	var exitErr *wkhtmltox.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Binary != "wkhtmltoimage" {
+		t.Fatalf("expected wkhtmltoimage to fail, got %v", err)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	out := []byte("Loading pages (1/6)\nWarning: Failed to load http://example.com/logo.png (ignore)\n[====>   ] 50%\n  Warning: Blocked access to file /etc/passwd\nDone\n")
+
+	expected := []string{"Failed to load http://example.com/logo.png (ignore)", "Blocked access to file /etc/passwd"}
+	got := wkhtmltox.ParseWarnings(out)
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
+	if got := (wkhtmltox.Output{Stderr: out}).Warnings(); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+}
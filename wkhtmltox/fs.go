@@ -0,0 +1,115 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// FSServer serves an fs.FS over HTTP on a random loopback port, so that a
+// document and its assets load exactly as they would from a web server:
+// relative and root-relative URLs, fonts and XHR all work without local file
+// access.
+type FSServer struct {
+	srv      *http.Server
+	listener net.Listener
+	done     chan struct{}
+}
+
+// ServeFS starts serving fsys on 127.0.0.1. The FSServer must be closed once
+// the conversion that uses it has finished.
+func ServeFS(fsys fs.FS) (*FSServer, error) {
+	return serveHandler(http.FileServerFS(fsys))
+}
+
+// serveHandler starts serving h on a random loopback port
+func serveHandler(h http.Handler) (*FSServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FSServer{
+		srv: &http.Server{
+			Handler:           h,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		listener: l,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		s.srv.Serve(l)
+	}()
+
+	return s, nil
+}
+
+// URL returns the address of name, a slash-separated path within the fs.FS
+func (s *FSServer) URL(name string) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   s.listener.Addr().String(),
+		Path:   path.Join("/", name),
+	}
+
+	return u.String()
+}
+
+// Close stops the server, dropping any open connections
+func (s *FSServer) Close() error {
+	err := s.srv.Close()
+	<-s.done
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// shutdown stops the server like Close, but waits for the requests in
+// progress to finish first
+func (s *FSServer) shutdown() error {
+	err := s.srv.Shutdown(context.Background())
+	<-s.done
+
+	return err
+}
+
+// GenerateFS performs the image conversion of entry, a file in fsys, which
+// is served from a loopback HTTP server for the duration of the conversion.
+// ex may be nil to use DefaultExecutor.
+func (ifs *ImageFlagSet) GenerateFS(ctx context.Context, ex Executor, fsys fs.FS, entry string, outputFile string) ([]byte, error) {
+	return ifs.GenerateSource(ctx, ex, FSSource{FS: fsys, Entry: entry}, outputFile)
+}
+
+// GenerateFS performs the PDF conversion of entry, a file in fsys, which is
+// served from a loopback HTTP server for the duration of the conversion. ex
+// may be nil to use DefaultExecutor.
+func (pfs *PDFFlagSet) GenerateFS(ctx context.Context, ex Executor, fsys fs.FS, entry string, outputFile string) ([]byte, error) {
+	return pfs.GenerateSource(ctx, ex, FSSource{FS: fsys, Entry: entry}, outputFile)
+}
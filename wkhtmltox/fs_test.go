@@ -0,0 +1,92 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+// fetchingExecutor fetches the input and a stylesheet linked from it, as a
+// converter would
+type fetchingExecutor struct {
+	input string
+	pages []string
+}
+
+func (fe *fetchingExecutor) Execute(ctx context.Context, e wkhtmltox.Execution) (wkhtmltox.Output, error) {
+	fe.input = e.Args[len(e.Args)-2]
+
+	for _, u := range []string{fe.input, strings.TrimSuffix(fe.input, "reports/index.html") + "static/site.css"} {
+		resp, err := http.Get(u)
+		if err != nil {
+			return wkhtmltox.Output{}, err
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fe.pages = append(fe.pages, string(data))
+	}
+
+	return wkhtmltox.Output{}, os.WriteFile(e.Args[len(e.Args)-1], wkhtmltoxtest.PDF(1), 0644)
+}
+
+var reportFS = fstest.MapFS{
+	"reports/index.html": {Data: []byte(`<link href="/static/site.css">`)},
+	"static/site.css":    {Data: []byte("body {}")},
+}
+
+func TestGenerateFS(t *testing.T) {
+	ex := &fetchingExecutor{}
+	pfs := wkhtmltox.PDFFlagSet{}
+
+	if _, err := pfs.GenerateFS(context.Background(), ex, reportFS, "reports/index.html", filepath.Join(t.TempDir(), "file.pdf")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !strings.HasPrefix(ex.input, "http://127.0.0.1:") || !strings.HasSuffix(ex.input, "/reports/index.html") {
+		t.Fatalf("expected a loopback URL, got %q", ex.input)
+	}
+
+	if len(ex.pages) != 2 || ex.pages[0] != `<link href="/static/site.css">` || ex.pages[1] != "body {}" {
+		t.Fatalf("unexpected pages %q", ex.pages)
+	}
+
+	if _, err := http.Get(ex.input); err == nil {
+		t.Fatal("expected the server to stop after the conversion")
+	}
+}
+
+func TestGenerateFSMissingEntry(t *testing.T) {
+	ifs := wkhtmltox.ImageFlagSet{}
+
+	_, err := ifs.GenerateFS(context.Background(), &fetchingExecutor{}, reportFS, "missing.html", "-")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
@@ -17,6 +17,10 @@
 
 package wkhtmltox
 
+import (
+	"context"
+)
+
 const (
 	imageConverterBinary = "wkhtmltoimage"
 )
@@ -26,6 +30,7 @@ type ImageFlagSet flagSet
 
 // ImageOptions represents wkhtmlimage attributes
 type ImageOptions struct {
+	Allow                   *[]string    `json:"allow,omitempty"`                     // Allow the files in these directories to be loaded when local file access is disabled
 	CacheDir                *string      `json:"cache_dir,omitempty"`                 // Web cache directory
 	Cookie                  *[]CookieSet `json:"cookie,omitempty"`                    // Set an additional cookie with URL encoded values
 	CropH                   *int         `json:"crop_h,omitempty"`                    // Set height for cropping
@@ -43,6 +48,7 @@ type ImageOptions struct {
 	JavascriptDelay         *int         `json:"javascript_delay,omitempty"`          // Milliseconds to wait for javascript to finish
 	LoadErrorHandling       *string      `json:"load_error_handling,omitempty"`       // Specify how to handle pages that fail to load
 	LoadMediaErrorHandling  *string      `json:"load_media_error_handling,omitempty"` // Specify how to handle media files that fail to load
+	LocalFileAccess         *bool        `json:"local_file_access,omitempty"`         // Allow or disallow loading local files
 	MinimumFontSize         *int         `json:"minimum_font_size,omitempty"`         // Minimum font size
 	Password                *string      `json:"password,omitempty"`                  // HTTP Authentication password
 	Quality                 *int         `json:"quality,omitempty"`                   // Output image quality
@@ -59,6 +65,10 @@ type ImageOptions struct {
 func NewImageFlagSetFromOptions(opts *ImageOptions) ImageFlagSet {
 	ifs := make(ImageFlagSet)
 
+	if opts.Allow != nil {
+		ifs.SetAllow(*opts.Allow)
+	}
+
 	if opts.CacheDir != nil {
 		ifs.SetCacheDir(*opts.CacheDir)
 	}
@@ -127,6 +137,10 @@ func NewImageFlagSetFromOptions(opts *ImageOptions) ImageFlagSet {
 		ifs.SetLoadMediaErrorHandling(*opts.LoadMediaErrorHandling)
 	}
 
+	if opts.LocalFileAccess != nil {
+		ifs.SetLocalFileAccess(*opts.LocalFileAccess)
+	}
+
 	if opts.MinimumFontSize != nil {
 		ifs.SetMinimumFontSize(*opts.MinimumFontSize)
 	}
@@ -174,7 +188,8 @@ func NewImageFlagSetFromOptions(opts *ImageOptions) ImageFlagSet {
 func (ifs *ImageFlagSet) Flags() []string {
 	var flags []string
 
-	for flagKey, flagValue := range *ifs {
+	for _, flagKey := range sortedFlagKeys(flagSet(*ifs)) {
+		flagValue := (*ifs)[flagKey]
 		switch flagValue.(type) {
 		case int:
 			evaluateIntFlag(&flags, flagKey, flagValue.(int))
@@ -200,6 +215,7 @@ func (ifs *ImageFlagSet) Flags() []string {
 			// Positive --enable-XXX, Negative --disable-XXX
 			type2Flags := []string{
 				"javascript",
+				"local-file-access",
 				"smart-width",
 			}
 
@@ -226,193 +242,176 @@ func (ifs *ImageFlagSet) Flags() []string {
 	return flags
 }
 
+// Has reports whether a flag is set in an ImageFlagSet
+func (ifs *ImageFlagSet) Has(key string) bool {
+	_, exists := (*ifs)[key]
+
+	return exists
+}
+
+// Unset removes a flag from an ImageFlagSet
+func (ifs *ImageFlagSet) Unset(key string) {
+	delete(*ifs, key)
+}
+
+// Clone returns a deep copy of an ImageFlagSet
+func (ifs *ImageFlagSet) Clone() ImageFlagSet {
+	return cloneFlagSet(*ifs)
+}
+
+// Equal reports whether two ImageFlagSets hold the same flags and values
+func (ifs *ImageFlagSet) Equal(other ImageFlagSet) bool {
+	return equalFlagSets(*ifs, other)
+}
+
+// GetAllow retrieves the Allow from an ImageFlagSet
+func (ifs *ImageFlagSet) GetAllow() ([]string, bool) {
+	return getFlag[[]string](*ifs, "allow")
+}
+
 // GetCacheDir retrieves the CacheDir from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCacheDir() (string, bool) {
-	dir, exists := (*ifs)["cache-dir"]
-
-	return dir.(string), exists
+	return getFlag[string](*ifs, "cache-dir")
 }
 
 // GetCookie retrieves the Cookie from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCookie() ([]CookieSet, bool) {
-	cookies, exists := (*ifs)["cookie"]
-
-	return cookies.([]CookieSet), exists
+	return getFlag[[]CookieSet](*ifs, "cookie")
 }
 
 // GetCropH retrieves the CropH from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCropH() (int, bool) {
-	height, exists := (*ifs)["crop-h"]
-
-	return height.(int), exists
+	return getFlag[int](*ifs, "crop-h")
 }
 
 // GetCropW retrieves the CropW from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCropW() (int, bool) {
-	width, exists := (*ifs)["crop-w"]
-
-	return width.(int), exists
+	return getFlag[int](*ifs, "crop-w")
 }
 
 // GetCropX retrieves the CropX from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCropX() (int, bool) {
-	xc, exists := (*ifs)["crop-x"]
-
-	return xc.(int), exists
+	return getFlag[int](*ifs, "crop-x")
 }
 
 // GetCropY retrieves the CropY from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCropY() (int, bool) {
-	yc, exists := (*ifs)["crop-y"]
-
-	return yc.(int), exists
+	return getFlag[int](*ifs, "crop-y")
 }
 
 // GetCustomHeader retrieves the CustomHeader from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCustomHeader() ([]HeaderSet, bool) {
-	headers, exists := (*ifs)["custom-header"]
-
-	return headers.([]HeaderSet), exists
+	return getFlag[[]HeaderSet](*ifs, "custom-header")
 }
 
 // GetCustomHeaderPropagation retrieves the CustomHeaderPropagation from an ImageFlagSet
 func (ifs *ImageFlagSet) GetCustomHeaderPropagation() (bool, bool) {
-	value, exists := (*ifs)["custom-header-propagation"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "custom-header-propagation")
 }
 
 // GetDebugJavascript retrieves the DebugJavascript from an ImageFlagSet
 func (ifs *ImageFlagSet) GetDebugJavascript() (bool, bool) {
-	value, exists := (*ifs)["debug-javascript"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "debug-javascript")
 }
 
 // GetEncoding retrieves the Encoding from an ImageFlagSet
 func (ifs *ImageFlagSet) GetEncoding() (string, bool) {
-	encoding, exists := (*ifs)["encoding"]
-
-	return encoding.(string), exists
+	return getFlag[string](*ifs, "encoding")
 }
 
 // GetFormat retrieves the Format from an ImageFlagSet
 func (ifs *ImageFlagSet) GetFormat() (string, bool) {
-	format, exists := (*ifs)["format"]
-
-	return format.(string), exists
+	return getFlag[string](*ifs, "format")
 }
 
 // GetHeight retrieves the Height from an ImageFlagSet
 func (ifs *ImageFlagSet) GetHeight() (int, bool) {
-	height, exists := (*ifs)["height"]
-
-	return height.(int), exists
+	return getFlag[int](*ifs, "height")
 }
 
 // GetImages retrieves the Images from an ImageFlagSet
 func (ifs *ImageFlagSet) GetImages() (bool, bool) {
-	value, exists := (*ifs)["images"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "images")
 }
 
 // GetJavascript retrieves the Javascript from an ImageFlagSet
 func (ifs *ImageFlagSet) GetJavascript() (bool, bool) {
-	value, exists := (*ifs)["javascript"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "javascript")
 }
 
 // GetJavascriptDelay retrieves the JavascriptDelay from an ImageFlagSet
 func (ifs *ImageFlagSet) GetJavascriptDelay() (int, bool) {
-	milliseconds, exists := (*ifs)["javascript-delay"]
-
-	return milliseconds.(int), exists
+	return getFlag[int](*ifs, "javascript-delay")
 }
 
 // GetLoadErrorHandling retrieves the LoadErrorHandling from an ImageFlagSet
 func (ifs *ImageFlagSet) GetLoadErrorHandling() (string, bool) {
-	handling, exists := (*ifs)["load-error-handling"]
-
-	return handling.(string), exists
+	return getFlag[string](*ifs, "load-error-handling")
 }
 
 // GetLoadMediaErrorHandling retrieves the LoadMediaErrorHandling from an ImageFlagSet
 func (ifs *ImageFlagSet) GetLoadMediaErrorHandling() (string, bool) {
-	handling, exists := (*ifs)["load-media-error-handling"]
+	return getFlag[string](*ifs, "load-media-error-handling")
+}
 
-	return handling.(string), exists
+// GetLocalFileAccess retrieves the LocalFileAccess from an ImageFlagSet
+func (ifs *ImageFlagSet) GetLocalFileAccess() (bool, bool) {
+	return getFlag[bool](*ifs, "local-file-access")
 }
 
 // GetMinimumFontSize retrieves the MinimumFontSize from an ImageFlagSet
 func (ifs *ImageFlagSet) GetMinimumFontSize() (int, bool) {
-	size, exists := (*ifs)["minimum-font-size"]
-
-	return size.(int), exists
+	return getFlag[int](*ifs, "minimum-font-size")
 }
 
 // GetPassword retrieves the Password from an ImageFlagSet
 func (ifs *ImageFlagSet) GetPassword() (string, bool) {
-	password, exists := (*ifs)["password"]
-
-	return password.(string), exists
+	return getFlag[string](*ifs, "password")
 }
 
 // GetQuality retrieves the Quality from an ImageFlagSet
 func (ifs *ImageFlagSet) GetQuality() (int, bool) {
-	quality, exists := (*ifs)["quality"]
-
-	return quality.(int), exists
+	return getFlag[int](*ifs, "quality")
 }
 
 // GetSmartWidth retrieves the SmartWidth from an ImageFlagSet
 func (ifs *ImageFlagSet) GetSmartWidth() (bool, bool) {
-	value, exists := (*ifs)["smart-width"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "smart-width")
 }
 
 // GetStopSlowScripts retrieves the StopSlowScripts from an ImageFlagSet
 func (ifs *ImageFlagSet) GetStopSlowScripts() (bool, bool) {
-	value, exists := (*ifs)["stop-slows-cripts"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "stop-slows-cripts")
 }
 
 // GetTransparent retrieves the Transparent from an ImageFlagSet
 func (ifs *ImageFlagSet) GetTransparent() (bool, bool) {
-	value, exists := (*ifs)["transparent"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "transparent")
 }
 
 // GetUseXServer retrieves the UseXServer from an ImageFlagSet
 func (ifs *ImageFlagSet) GetUseXServer() (bool, bool) {
-	value, exists := (*ifs)["use-xserver"]
-
-	return value.(bool), exists
+	return getFlag[bool](*ifs, "use-xserver")
 }
 
 // GetUsername retrieves the Username from an ImageFlagSet
 func (ifs *ImageFlagSet) GetUsername() (string, bool) {
-	username, exists := (*ifs)["username"]
-
-	return username.(string), exists
+	return getFlag[string](*ifs, "username")
 }
 
 // GetWidth retrieves the Width from an ImageFlagSet
 func (ifs *ImageFlagSet) GetWidth() (int, bool) {
-	width, exists := (*ifs)["width"]
-
-	return width.(int), exists
+	return getFlag[int](*ifs, "width")
 }
 
 // GetZoom retrieves the Zoom from an ImageFlagSet
 func (ifs *ImageFlagSet) GetZoom() (float64, bool) {
-	zoom, exists := (*ifs)["zoom"]
+	return getFlag[float64](*ifs, "zoom")
+}
 
-	return zoom.(float64), exists
+// SetAllow sets the Allow of an ImageFlagSet
+func (ifs *ImageFlagSet) SetAllow(dirs []string) {
+	(*ifs)["allow"] = dirs
 }
 
 // SetCacheDir sets the CacheDir of an ImageFlagSet
@@ -500,6 +499,11 @@ func (ifs *ImageFlagSet) SetLoadMediaErrorHandling(handling string) {
 	(*ifs)["load-media-error-handling"] = handling
 }
 
+// SetLocalFileAccess sets the LocalFileAccess of an ImageFlagSet
+func (ifs *ImageFlagSet) SetLocalFileAccess(value bool) {
+	(*ifs)["local-file-access"] = value
+}
+
 // SetMinimumFontSize sets the MinimumFontSize of an ImageFlagSet
 func (ifs *ImageFlagSet) SetMinimumFontSize(size int) {
 	(*ifs)["minimum-font-size"] = size
@@ -552,7 +556,12 @@ func (ifs *ImageFlagSet) SetZoom(zoom float64) {
 
 // Generate performs the image conversion and saves the file to disk
 func (ifs *ImageFlagSet) Generate(inputURL string, outputFile string) ([]byte, error) {
-	out, err := runConversionCommand(imageConverterBinary, ifs.Flags(), &inputURL, &outputFile)
+	return ifs.GenerateContext(context.Background(), nil, inputURL, outputFile)
+}
 
-	return out, err
+// GenerateContext performs the image conversion using ex, or DefaultExecutor
+// if ex is nil, and saves the file to disk. The image is written to a
+// temporary file and renamed to outputFile only if it is well formed.
+func (ifs *ImageFlagSet) GenerateContext(ctx context.Context, ex Executor, inputURL string, outputFile string) ([]byte, error) {
+	return generateFile(ctx, ex, newOutputCheck(ImageConverter, flagSet(*ifs)), URLSource{URL: inputURL}, outputFile, ifs.Command)
 }
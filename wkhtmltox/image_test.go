@@ -206,6 +206,22 @@ func TestImageFlagSetFlags(t *testing.T) {
 		t.Fatalf("expected '%s' but got '%s'", expected, got)
 	}
 
+	ifs = make(wkhtmltox.ImageFlagSet)
+	ifs["local-file-access"] = false
+	expected = []string{"--disable-local-file-access"}
+	got = ifs.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
+	ifs = make(wkhtmltox.ImageFlagSet)
+	ifs["allow"] = []string{"/some/dir", "/other/dir"}
+	expected = []string{"--allow", "/some/dir", "--allow", "/other/dir"}
+	got = ifs.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
 	ifs = make(wkhtmltox.ImageFlagSet)
 	ifs["javascript-delay"] = 200
 	expected = []string{"--javascript-delay", "200"}
@@ -342,6 +358,97 @@ func TestImageFlagSetFlags(t *testing.T) {
 
 }
 
+func TestImageFlagSetHas(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs["zoom"] = 1.5
+
+	if !ifs.Has("zoom") {
+		t.Fatalf("expected %s to be set", "zoom")
+	}
+
+	if ifs.Has("encoding") {
+		t.Fatalf("expected %s not to be set", "encoding")
+	}
+}
+
+func TestImageFlagSetUnset(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs["zoom"] = 1.5
+	ifs.Unset("zoom")
+
+	if _, exists := ifs["zoom"]; exists {
+		t.Fatalf("expected %s to be unset, got %v", "zoom", ifs["zoom"])
+	}
+}
+
+func TestImageFlagSetClone(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs["cookie"] = []wkhtmltox.CookieSet{
+		wkhtmltox.CookieSet{
+			Name:  "cookie1",
+			Value: "value1",
+		},
+	}
+	clone := ifs.Clone()
+
+	if !ifs.Equal(clone) {
+		t.Fatalf("expected clone '%v' to equal '%v'", clone, ifs)
+	}
+
+	clone["cookie"].([]wkhtmltox.CookieSet)[0].Value = "changed"
+	clone["zoom"] = 1.5
+	if ifs["cookie"].([]wkhtmltox.CookieSet)[0].Value != "value1" || ifs.Has("zoom") {
+		t.Fatalf("expected original to be unaffected by changes to clone, got '%v'", ifs)
+	}
+}
+
+func TestImageFlagSetEqual(t *testing.T) {
+	a := make(wkhtmltox.ImageFlagSet)
+	a["encoding"] = "utf-8"
+	b := make(wkhtmltox.ImageFlagSet)
+	b["encoding"] = "utf-8"
+
+	if !a.Equal(b) {
+		t.Fatalf("expected '%v' to equal '%v'", a, b)
+	}
+
+	b["encoding"] = "latin-1"
+	if a.Equal(b) {
+		t.Fatalf("expected '%v' not to equal '%v'", a, b)
+	}
+
+	delete(b, "encoding")
+	b["zoom"] = 1.5
+	if a.Equal(b) {
+		t.Fatalf("expected '%v' not to equal '%v'", a, b)
+	}
+}
+
+func TestImageFlagSetGetWhenAbsent(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+
+	if value, exists := ifs.GetCacheDir(); exists || value != "" {
+		t.Fatalf("expected %s to be absent, got %q", "cache-dir", value)
+	}
+
+	ifs["zoom"] = "1.5"
+	if value, exists := ifs.GetZoom(); exists || value != 0 {
+		t.Fatalf("expected %s of the wrong type to be reported absent, got %v", "zoom", value)
+	}
+}
+
+func TestImageFlagSetGetAllow(t *testing.T) {
+	attribute := "allow"
+	dirs := []string{"/tmp/xyz"}
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs[attribute] = dirs
+	result, exists := ifs.GetAllow()
+
+	if !exists || !reflect.DeepEqual(result, dirs) {
+		t.Fatalf("expected %s to be %s, got %s", attribute, dirs, result)
+	}
+}
+
 func TestImageFlagSetGetCacheDir(t *testing.T) {
 	attribute := "cache-dir"
 	dir := "/tmp/xyz"
@@ -564,6 +671,18 @@ func TestImageFlagSetGetLoadMediaErrorHandling(t *testing.T) {
 	}
 }
 
+func TestImageFlagSetGetLocalFileAccess(t *testing.T) {
+	attribute := "local-file-access"
+	value := false
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs[attribute] = value
+	result, exists := ifs.GetLocalFileAccess()
+
+	if !exists || result != value {
+		t.Fatalf("expected %s to be %t, got %t", attribute, value, result)
+	}
+}
+
 func TestImageFlagSetGetMinimumFontSize(t *testing.T) {
 	attribute := "minimum-font-size"
 	size := 12
@@ -684,6 +803,17 @@ func TestImageFlagSetGetZoom(t *testing.T) {
 	}
 }
 
+func TestImageFlagSetSetAllow(t *testing.T) {
+	attribute := "allow"
+	dirs := []string{"/tmp/xyz"}
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs.SetAllow(dirs)
+
+	if !reflect.DeepEqual(ifs[attribute], dirs) {
+		t.Fatalf("expected %s to be %s, got %s", attribute, dirs, ifs[attribute])
+	}
+}
+
 func TestImageFlagSetSetCacheDir(t *testing.T) {
 	attribute := "cache-dir"
 	dir := "/tmp/xyz"
@@ -889,6 +1019,17 @@ func TestImageFlagSetSetLoadMediaErrorHandling(t *testing.T) {
 	}
 }
 
+func TestImageFlagSetSetLocalFileAccess(t *testing.T) {
+	attribute := "local-file-access"
+	value := false
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs.SetLocalFileAccess(value)
+
+	if ifs[attribute] != value {
+		t.Fatalf("expected %s to be %t, got %t", attribute, value, ifs[attribute])
+	}
+}
+
 func TestImageFlagSetSetMinimumFontSize(t *testing.T) {
 	attribute := "minimum-font-size"
 	size := 12
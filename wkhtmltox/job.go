@@ -0,0 +1,220 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ConverterKind identifies which converter a Job runs
+type ConverterKind string
+
+const (
+	// ImageConverter converts using wkhtmltoimage
+	ImageConverter ConverterKind = "image"
+
+	// PDFConverter converts using wkhtmltopdf
+	PDFConverter ConverterKind = "pdf"
+)
+
+// Binary returns the name of the converter executable
+func (k ConverterKind) Binary() (string, error) {
+	switch k {
+	case ImageConverter:
+		return imageConverterBinary, nil
+	case PDFConverter:
+		return pdfConverterBinary, nil
+	}
+
+	return "", fmt.Errorf("wkhtmltox: unknown converter kind %q", string(k))
+}
+
+// Job is an immutable specification of a single conversion. The flags are
+// frozen when the Job is built, so a Job can be shared between goroutines and
+// serialized to JSON to be run by another process.
+type Job struct {
+	kind    ConverterKind
+	input   string
+	output  string
+	options json.RawMessage
+	flags   flagSet
+}
+
+type jobJSON struct {
+	Kind    ConverterKind   `json:"kind"`
+	Input   string          `json:"input"`
+	Output  string          `json:"output"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// NewImageJob builds a Job that converts inputURL to an image at outputFile
+func NewImageJob(inputURL string, outputFile string, opts *ImageOptions) (Job, error) {
+	if opts == nil {
+		opts = &ImageOptions{}
+	}
+
+	return newJob(ImageConverter, inputURL, outputFile, opts)
+}
+
+// NewPDFJob builds a Job that converts inputURL to a PDF at outputFile
+func NewPDFJob(inputURL string, outputFile string, opts *PDFOptions) (Job, error) {
+	if opts == nil {
+		opts = &PDFOptions{}
+	}
+
+	return newJob(PDFConverter, inputURL, outputFile, opts)
+}
+
+func newJob(kind ConverterKind, inputURL string, outputFile string, opts interface{}) (Job, error) {
+	// The options are kept in their JSON form, which both freezes them and
+	// preserves their types across serialization.
+	raw, err := json.Marshal(opts)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return buildJob(kind, inputURL, outputFile, raw)
+}
+
+func buildJob(kind ConverterKind, inputURL string, outputFile string, raw json.RawMessage) (Job, error) {
+	var fs flagSet
+
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+
+	switch kind {
+	case ImageConverter:
+		var opts ImageOptions
+		if err := json.Unmarshal(raw, &opts); err != nil {
+			return Job{}, err
+		}
+		fs = flagSet(NewImageFlagSetFromOptions(&opts))
+	case PDFConverter:
+		var opts PDFOptions
+		if err := json.Unmarshal(raw, &opts); err != nil {
+			return Job{}, err
+		}
+		fs = flagSet(NewPDFFlagSetFromOptions(&opts))
+	default:
+		_, err := kind.Binary()
+		return Job{}, err
+	}
+
+	return Job{
+		kind:    kind,
+		input:   inputURL,
+		output:  outputFile,
+		options: append(json.RawMessage(nil), raw...),
+		flags:   fs,
+	}, nil
+}
+
+// Kind returns the converter the Job runs
+func (j Job) Kind() ConverterKind {
+	return j.kind
+}
+
+// Input returns the URL or path the Job converts
+func (j Job) Input() string {
+	return j.input
+}
+
+// Output returns the file the Job writes to
+func (j Job) Output() string {
+	return j.output
+}
+
+// ImageFlagSet returns a copy of the flags of an image Job
+func (j Job) ImageFlagSet() (ImageFlagSet, bool) {
+	if j.kind != ImageConverter {
+		return nil, false
+	}
+
+	return ImageFlagSet(cloneFlagSet(j.flags)), true
+}
+
+// PDFFlagSet returns a copy of the flags of a PDF Job
+func (j Job) PDFFlagSet() (PDFFlagSet, bool) {
+	if j.kind != PDFConverter {
+		return nil, false
+	}
+
+	return PDFFlagSet(cloneFlagSet(j.flags)), true
+}
+
+// Flags generates a String slice from the frozen flags of a Job
+func (j Job) Flags() []string {
+	switch j.kind {
+	case ImageConverter:
+		ifs := ImageFlagSet(j.flags)
+		return ifs.Flags()
+	case PDFConverter:
+		pfs := PDFFlagSet(j.flags)
+		return pfs.Flags()
+	}
+
+	return nil
+}
+
+// Generate performs the conversion described by the Job
+func (j Job) Generate() ([]byte, error) {
+	return j.GenerateContext(context.Background(), nil)
+}
+
+// GenerateContext performs the conversion described by the Job using ex, or
+// DefaultExecutor if ex is nil
+func (j Job) GenerateContext(ctx context.Context, ex Executor) ([]byte, error) {
+	binary, err := j.kind.Binary()
+	if err != nil {
+		return nil, err
+	}
+
+	return generateFile(ctx, ex, newOutputCheck(j.kind, j.flags), URLSource{URL: j.input}, j.output, func(inputURL string, outputFile string) (Command, error) {
+		return newCommand(binary, j.flags, j.Flags(), inputURL, outputFile)
+	})
+}
+
+// MarshalJSON encodes the Job with its options in the same JSON format that
+// ImageOptions and PDFOptions use
+func (j Job) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jobJSON{
+		Kind:    j.kind,
+		Input:   j.input,
+		Output:  j.output,
+		Options: j.options,
+	})
+}
+
+// UnmarshalJSON decodes a Job encoded by MarshalJSON
+func (j *Job) UnmarshalJSON(data []byte) error {
+	var enc jobJSON
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+
+	job, err := buildJob(enc.Kind, enc.Input, enc.Output, enc.Options)
+	if err != nil {
+		return err
+	}
+	*j = job
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+func TestNewPDFJob(t *testing.T) {
+	pageSize := "A4"
+	opts := wkhtmltox.PDFOptions{PageSize: &pageSize}
+	job, err := wkhtmltox.NewPDFJob("http://example.com", "/tmp/file.pdf", &opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// changing the options afterwards does not affect the job
+	pageSize = "Letter"
+	expected := []string{"--page-size", "A4"}
+	got := job.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
+	if job.Kind() != wkhtmltox.PDFConverter || job.Input() != "http://example.com" || job.Output() != "/tmp/file.pdf" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func TestJobFlagSetIsACopy(t *testing.T) {
+	width := 640
+	job, _ := wkhtmltox.NewImageJob("http://example.com", "/tmp/file.png", &wkhtmltox.ImageOptions{Width: &width})
+
+	ifs, ok := job.ImageFlagSet()
+	if !ok {
+		t.Fatal("expected an image job to have an ImageFlagSet")
+	}
+	ifs.SetWidth(1024)
+
+	if _, ok := job.PDFFlagSet(); ok {
+		t.Fatal("expected an image job not to have a PDFFlagSet")
+	}
+
+	expected := []string{"--width", "640"}
+	got := job.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+}
+
+func TestJobConcurrentUse(t *testing.T) {
+	grayscale := true
+	job, _ := wkhtmltox.NewPDFJob("http://example.com", "/tmp/file.pdf", &wkhtmltox.PDFOptions{Grayscale: &grayscale})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pfs, _ := job.PDFFlagSet()
+			pfs.SetTitle("title")
+			job.Flags()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestJobJSON(t *testing.T) {
+	cookies := []wkhtmltox.CookieSet{{Name: "cookie1", Value: "value1"}}
+	dpi := 300
+	job, _ := wkhtmltox.NewPDFJob("http://example.com", "/tmp/file.pdf", &wkhtmltox.PDFOptions{Cookie: &cookies, DPI: &dpi})
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectedJSON := `{"kind":"pdf","input":"http://example.com","output":"/tmp/file.pdf","options":{"cookies":[{"name":"cookie1","value":"value1"}],"dpi":300}}`
+	if string(data) != expectedJSON {
+		t.Fatalf("expected '%s' but got '%s'", expectedJSON, data)
+	}
+
+	var decoded wkhtmltox.Job
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	pfs, _ := job.PDFFlagSet()
+	decodedPfs, _ := decoded.PDFFlagSet()
+	if !pfs.Equal(decodedPfs) || decoded.Input() != job.Input() || decoded.Output() != job.Output() {
+		t.Fatalf("expected '%+v' to round-trip, got '%+v'", job, decoded)
+	}
+}
+
+func TestJobJSONUnknownKind(t *testing.T) {
+	var job wkhtmltox.Job
+	err := json.Unmarshal([]byte(`{"kind":"gif","input":"a","output":"b"}`), &job)
+	if err == nil {
+		t.Fatal("expected an error for an unknown converter kind")
+	}
+}
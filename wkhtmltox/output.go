@@ -0,0 +1,266 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // Decoders for the formats outputCheck inspects
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+)
+
+// OutputProblem identifies why a generated document failed validation
+type OutputProblem string
+
+// Problems reported in an OutputError
+const (
+	EmptyOutput     OutputProblem = "empty"      // The file is empty
+	MalformedOutput OutputProblem = "malformed"  // The file is truncated or not of the expected format
+	NoPages         OutputProblem = "no_pages"   // The PDF has no pages
+	WrongDimensions OutputProblem = "dimensions" // The image is not the size its options ask for
+	BlankImage      OutputProblem = "blank"      // The image is a single color, as when a page fails to paint
+)
+
+// OutputError is returned when a converter reports success but the document
+// it wrote fails validation, as happens when it crashes or is killed part way
+// through or fails to paint the page
+type OutputError struct {
+	Path    string // File the converter wrote
+	Problem OutputProblem
+	Reason  string
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("wkhtmltox: output %s failed validation: %s", e.Path, e.Reason)
+}
+
+// pdfTrailerWindow is how far from the end of a PDF the %%EOF marker is
+// looked for, since writers may append whitespace or garbage after it
+const pdfTrailerWindow = 1024
+
+// imageSignatures are the leading bytes of the formats wkhtmltoimage writes
+var imageSignatures = [][]byte{
+	[]byte("\x89PNG\r\n\x1a\n"),
+	[]byte("\xff\xd8\xff"), // JPEG
+	[]byte("BM"),           // BMP
+	[]byte("GIF8"),
+	[]byte("II*\x00"), // TIFF, little endian
+	[]byte("MM\x00*"), // TIFF, big endian
+	[]byte("P6"),      // PPM
+	[]byte("<?xml"),   // SVG
+	[]byte("<svg"),
+}
+
+// blankTolerance is how far, out of 0xffff, a color channel may differ from
+// the background and still count as blank, to allow for JPEG noise
+const blankTolerance = 0x0800
+
+// blankSamples bounds how many pixels the blank image check looks at
+const blankSamples = 250000
+
+// outputCheck describes what a generated document must look like
+type outputCheck struct {
+	kind           ConverterKind
+	ext            string  // Extension the converter picks the output format from
+	width          int     // Expected image width, zero if unconstrained
+	minWidth       bool    // Whether width is only a minimum, as with smart width
+	height         int     // Expected image height, zero if unconstrained
+	blankThreshold float64 // Share of background pixels that makes an image blank, zero to skip the check
+	rewrite        pdfRewrite
+}
+
+// newOutputCheck returns the checks for a conversion with the flags fs. Crop
+// sizes are exact; an image is at least as wide as --width unless smart width
+// is disabled, and as high as --height if it is set. PDFs are rewritten as
+// the flags ask.
+func newOutputCheck(kind ConverterKind, fs flagSet) outputCheck {
+	oc := outputCheck{kind: kind, ext: ".pdf"}
+	if kind == PDFConverter {
+		oc.rewrite = newPDFRewrite(PDFFlagSet(fs))
+	}
+	if kind != ImageConverter {
+		return oc
+	}
+
+	oc.ext = ".png"
+	if format, ok := getFlag[string](fs, "format"); ok {
+		oc.ext = "." + format
+	}
+
+	if width, ok := getFlag[int](fs, "crop-w"); ok && width > 0 {
+		oc.width = width
+	} else if width, ok := getFlag[int](fs, "width"); ok && width > 0 {
+		oc.width = width
+		smart, set := getFlag[bool](fs, "smart-width")
+		oc.minWidth = !set || smart
+	}
+
+	if height, ok := getFlag[int](fs, "crop-h"); ok && height > 0 {
+		oc.height = height
+	} else if height, ok := getFlag[int](fs, "height"); ok && height > 0 {
+		oc.height = height
+	}
+
+	return oc
+}
+
+// finish validates the document at path, then rewrites it if it is a PDF
+// that needs rewriting
+func (oc outputCheck) finish(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return &OutputError{Path: path, Problem: EmptyOutput, Reason: "file is empty"}
+	}
+
+	switch oc.kind {
+	case PDFConverter:
+		if err := oc.checkPDF(path, data); err != nil {
+			return err
+		}
+	case ImageConverter:
+		return oc.checkImage(path, data)
+	}
+
+	if oc.kind != PDFConverter || !oc.rewrite.needed() {
+		return nil
+	}
+
+	if data, err = oc.rewrite.apply(data); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func (oc outputCheck) checkPDF(path string, data []byte) error {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return &OutputError{Path: path, Problem: MalformedOutput, Reason: "missing %PDF- header"}
+	}
+
+	if !bytes.Contains(data[max(0, len(data)-pdfTrailerWindow):], []byte("%%EOF")) {
+		return &OutputError{Path: path, Problem: MalformedOutput, Reason: "missing %%EOF trailer, the file is probably truncated"}
+	}
+
+	info, err := ReadPDFInfo(data)
+	if err != nil {
+		return &OutputError{Path: path, Problem: MalformedOutput, Reason: err.Error()}
+	}
+	if info.Pages == 0 {
+		return &OutputError{Path: path, Problem: NoPages, Reason: "PDF has no pages"}
+	}
+
+	return nil
+}
+
+func (oc outputCheck) checkImage(path string, data []byte) error {
+	head := bytes.TrimLeft(data[:min(len(data), 64)], " \t\r\n")
+
+	known := false
+	for _, signature := range imageSignatures {
+		if bytes.HasPrefix(head, signature) {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return &OutputError{Path: path, Problem: MalformedOutput, Reason: "not a recognized image format"}
+	}
+
+	// Only formats the standard library decodes can be inspected further
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err == image.ErrFormat {
+		return nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return &OutputError{Path: path, Problem: MalformedOutput, Reason: fmt.Sprintf("image does not decode: %v", err)}
+	}
+
+	size := img.Bounds().Size()
+	widthOK := oc.width == 0 || size.X == oc.width || (oc.minWidth && size.X > oc.width)
+	heightOK := oc.height == 0 || size.Y == oc.height
+	if !widthOK || !heightOK {
+		return &OutputError{Path: path, Problem: WrongDimensions, Reason: fmt.Sprintf("image is %dx%d, expected %s", size.X, size.Y, oc.describeSize())}
+	}
+
+	if oc.blankThreshold > 0 {
+		if share := backgroundShare(img); share >= oc.blankThreshold {
+			return &OutputError{Path: path, Problem: BlankImage, Reason: fmt.Sprintf("%.2f%% of the image is background", share*100)}
+		}
+	}
+
+	return nil
+}
+
+// describeSize formats the expected image size, with "any" for an
+// unconstrained side
+func (oc outputCheck) describeSize() string {
+	width, height := "any width", "any height"
+	if oc.width > 0 {
+		width = fmt.Sprintf("%d", oc.width)
+		if oc.minWidth {
+			width = fmt.Sprintf("at least %d", oc.width)
+		}
+	}
+	if oc.height > 0 {
+		height = fmt.Sprintf("%d", oc.height)
+	}
+
+	return width + " by " + height
+}
+
+// backgroundShare returns the share of pixels that match the color of the
+// top-left pixel, sampling a grid of at most blankSamples pixels
+func backgroundShare(img image.Image) float64 {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return 1
+	}
+
+	step := max(1, int(math.Sqrt(float64(bounds.Dx()*bounds.Dy())/blankSamples)))
+	br, bg, bb, ba := img.At(bounds.Min.X, bounds.Min.Y).RGBA()
+
+	var samples, matches int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			samples++
+			if near(r, br) && near(g, bg) && near(b, bb) && near(a, ba) {
+				matches++
+			}
+		}
+	}
+
+	return float64(matches) / float64(samples)
+}
+
+func near(a uint32, b uint32) bool {
+	if a > b {
+		return a-b <= blankTolerance
+	}
+
+	return b-a <= blankTolerance
+}
@@ -0,0 +1,182 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func expectOnly(t *testing.T, target string, data string) {
+	t.Helper()
+
+	if got, err := os.ReadFile(target); err != nil || string(got) != data {
+		t.Fatalf("expected %s to hold %q, got %q (%v)", target, data, got, err)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Fatalf("expected only %s to remain, got %d entries", target, len(entries))
+	}
+}
+
+func TestGenerateCrashKeepsPrevious(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	target := filepath.Join(t.TempDir(), "report.pdf")
+	os.WriteFile(target, []byte("previous"), 0644)
+	pfs := wkhtmltox.PDFFlagSet{}
+
+	if _, err := pfs.Generate(wkhtmltoxtest.CrashURL, target); err == nil {
+		t.Fatal("expected an error")
+	}
+	expectOnly(t, target, "previous")
+
+	if _, err := pfs.Generate("http://example.com", target); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if data, _ := os.ReadFile(target); !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Fatalf("expected the PDF to replace the previous file, got %q", data)
+	}
+}
+
+func TestGenerateMalformedOutput(t *testing.T) {
+	truncatedPNG := wkhtmltoxtest.PNG(8, 8)
+	truncatedPNG = truncatedPNG[:len(truncatedPNG)-20]
+
+	for name, tc := range map[string]struct {
+		kind    wkhtmltox.ConverterKind
+		output  []byte
+		problem wkhtmltox.OutputProblem
+	}{
+		"truncated pdf":   {wkhtmltox.PDFConverter, []byte("%PDF-1.4\n1 0 obj"), wkhtmltox.MalformedOutput},
+		"html as pdf":     {wkhtmltox.PDFConverter, []byte("<html>%%EOF"), wkhtmltox.MalformedOutput},
+		"pdf of no pages": {wkhtmltox.PDFConverter, wkhtmltoxtest.PDF(0), wkhtmltox.NoPages},
+		"empty pdf":       {wkhtmltox.PDFConverter, nil, wkhtmltox.EmptyOutput},
+		"empty image":     {wkhtmltox.ImageConverter, nil, wkhtmltox.EmptyOutput},
+		"text as image":   {wkhtmltox.ImageConverter, []byte("Segmentation fault"), wkhtmltox.MalformedOutput},
+		"truncated image": {wkhtmltox.ImageConverter, truncatedPNG, wkhtmltox.MalformedOutput},
+	} {
+		t.Run(name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "out")
+			os.WriteFile(target, []byte("previous"), 0644)
+			ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: tc.output})
+
+			var err error
+			if tc.kind == wkhtmltox.PDFConverter {
+				pfs := wkhtmltox.PDFFlagSet{}
+				_, err = pfs.GenerateContext(context.Background(), ex, "http://example.com", target)
+			} else {
+				ifs := wkhtmltox.ImageFlagSet{}
+				_, err = ifs.GenerateContext(context.Background(), ex, "http://example.com", target)
+			}
+
+			var outputErr *wkhtmltox.OutputError
+			if !errors.As(err, &outputErr) || outputErr.Problem != tc.problem {
+				t.Fatalf("expected a %s OutputError, got %v", tc.problem, err)
+			}
+			expectOnly(t, target, "previous")
+		})
+	}
+}
+
+func TestGenerateKeepsExtension(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.JPEG(8, 8)})
+	target := filepath.Join(t.TempDir(), "shot.jpg")
+	job, _ := wkhtmltox.NewImageJob("http://example.com", target, nil)
+
+	if _, err := job.GenerateContext(context.Background(), ex); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if args := ex.Calls()[0].Args; filepath.Ext(args[len(args)-1]) != ".jpg" {
+		t.Fatalf("expected the converter to write a .jpg, got %s", args)
+	}
+	expectOnly(t, target, string(wkhtmltoxtest.JPEG(8, 8)))
+}
+
+func TestGenerateImageDimensions(t *testing.T) {
+	ifs := func(set func(ifs *wkhtmltox.ImageFlagSet)) wkhtmltox.ImageFlagSet {
+		ifs := wkhtmltox.ImageFlagSet{}
+		set(&ifs)
+		return ifs
+	}
+
+	for name, tc := range map[string]struct {
+		flags wkhtmltox.ImageFlagSet
+		ok    bool
+	}{
+		"unconstrained":          {ifs(func(ifs *wkhtmltox.ImageFlagSet) {}), true},
+		"smart width":            {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetWidth(600) }), true},
+		"smart width too narrow": {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetWidth(1200) }), false},
+		"strict width":           {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetWidth(600); ifs.SetSmartWidth(false) }), false},
+		"height":                 {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetHeight(600) }), true},
+		"wrong height":           {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetHeight(700) }), false},
+		"crop":                   {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetWidth(1200); ifs.SetCropW(800); ifs.SetCropH(600) }), true},
+		"wrong crop":             {ifs(func(ifs *wkhtmltox.ImageFlagSet) { ifs.SetCropW(400) }), false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(800, 600)})
+			target := filepath.Join(t.TempDir(), "shot.png")
+
+			_, err := tc.flags.GenerateContext(context.Background(), ex, "http://example.com", target)
+
+			var outputErr *wkhtmltox.OutputError
+			if tc.ok && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			} else if !tc.ok && (!errors.As(err, &outputErr) || outputErr.Problem != wkhtmltox.WrongDimensions) {
+				t.Fatalf("expected a dimensions OutputError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRendererBlankImage(t *testing.T) {
+	painted := image.NewGray(image.Rect(0, 0, 100, 100))
+	for i := range painted.Pix {
+		painted.Pix[i] = 0xff
+		if i%100 < 10 {
+			painted.Pix[i] = 0
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, painted)
+
+	ex := wkhtmltoxtest.NewExecutor(
+		wkhtmltoxtest.Response{OutputFile: buf.Bytes()},
+		wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(100, 100)},
+	)
+	renderer := wkhtmltox.LocalRenderer{Executor: ex, BlankThreshold: 0.99}
+
+	if _, err := renderer.Image(context.Background(), "http://example.com", nil); err != nil {
+		t.Fatalf("expected a painted image to pass, got %v", err)
+	}
+
+	var outputErr *wkhtmltox.OutputError
+	if _, err := renderer.Image(context.Background(), "http://example.com", nil); !errors.As(err, &outputErr) || outputErr.Problem != wkhtmltox.BlankImage {
+		t.Fatalf("expected a blank OutputError, got %v", err)
+	}
+}
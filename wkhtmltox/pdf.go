@@ -17,6 +17,10 @@
 
 package wkhtmltox
 
+import (
+	"context"
+)
+
 const (
 	pdfConverterBinary = "wkhtmltopdf"
 )
@@ -26,6 +30,7 @@ type PDFFlagSet flagSet
 
 // PDFOptions represents wkhtmlpdf attributes
 type PDFOptions struct {
+	Allow                   *[]string    `json:"allow,omitempty"`                     // Allow the files in these directories to be loaded when local file access is disabled
 	CacheDir                *string      `json:"cache_dir,omitempty"`                 // Web cache directory
 	Cookie                  *[]CookieSet `json:"cookies,omitempty"`                   // Set an additional cookie with url encoded values
 	CustomHeader            *[]HeaderSet `json:"custom_headers,omitempty"`            // Set an additional HTTP header
@@ -44,11 +49,13 @@ type PDFOptions struct {
 	JavascriptDelay         *int         `json:"javascript_delay,omitempty"`          // Milliseconds to wait for javascript to finish
 	LoadErrorHandling       *string      `json:"load_error_handling,omitempty"`       // Specify how to handle pages that fail to load
 	LoadMediaErrorHandling  *string      `json:"load_media_error_handling,omitempty"` // Specify how to handle media files that fail to load
+	LocalFileAccess         *bool        `json:"local_file_access,omitempty"`         // Allow or disallow loading local files
 	LowQuality              *bool        `json:"lowquality,omitempty"`                // Generates lower quality PDF/PS
 	MarginBottom            *int         `json:"margin_bottom,omitempty"`             // Set the page bottom margin
 	MarginLeft              *int         `json:"margin_left,omitempty"`               // Set the page left margin
 	MarginRight             *int         `json:"margin_right,omitempty"`              // Set the page right margin
 	MarginTop               *int         `json:"margin_top,omitempty"`                // Set the page top margin
+	Metadata                *PDFMetadata `json:"metadata,omitempty"`                  // Set document information such as the author after conversion
 	MinimumFontSize         *int         `json:"minimum_font_size,omitempty"`         // Minimum font size
 	NoPDFCompression        *bool        `json:"no_pdf_compression,omitempty"`        // Do not use lossless compression on PDF objects
 	Orientation             *string      `json:"orientation,omitempty"`               // Set orientation to landscape or portrait
@@ -56,6 +63,7 @@ type PDFOptions struct {
 	PageSize                *string      `json:"page_size,omitempty"`                 // Size of the page
 	PageWidth               *int         `json:"page_width,omitempty"`                // Width of the page
 	Password                *string      `json:"password,omitempty"`                  // HTTP Authentication password
+	Reproducible            *bool        `json:"reproducible,omitempty"`              // Post-process the PDF so that the same input always gives the same bytes
 	SmartShrinking          *bool        `json:"smart_width,omitempty"`               // Enable the intelligent shrinking strategy used by WebKit that makes the pixel/dpi ratio none constant
 	StopSlowScripts         *bool        `json:"stop_slow_scripts,omitempty"`         // Stop slow running javascripts
 	Title                   *string      `json:"title,omitempty"`                     // The title of the generated PDF file
@@ -68,6 +76,10 @@ type PDFOptions struct {
 func NewPDFFlagSetFromOptions(opts *PDFOptions) PDFFlagSet {
 	pfs := make(PDFFlagSet)
 
+	if opts.Allow != nil {
+		pfs.SetAllow(*opts.Allow)
+	}
+
 	if opts.CacheDir != nil {
 		pfs.SetCacheDir(*opts.CacheDir)
 	}
@@ -140,6 +152,10 @@ func NewPDFFlagSetFromOptions(opts *PDFOptions) PDFFlagSet {
 		pfs.SetLoadMediaErrorHandling(*opts.LoadMediaErrorHandling)
 	}
 
+	if opts.LocalFileAccess != nil {
+		pfs.SetLocalFileAccess(*opts.LocalFileAccess)
+	}
+
 	if opts.LowQuality != nil {
 		pfs.SetLowQuality(*opts.LowQuality)
 	}
@@ -160,6 +176,10 @@ func NewPDFFlagSetFromOptions(opts *PDFOptions) PDFFlagSet {
 		pfs.SetMarginTop(*opts.MarginTop)
 	}
 
+	if opts.Metadata != nil {
+		pfs.SetMetadata(*opts.Metadata)
+	}
+
 	if opts.MinimumFontSize != nil {
 		pfs.SetMinimumFontSize(*opts.MinimumFontSize)
 	}
@@ -188,6 +208,10 @@ func NewPDFFlagSetFromOptions(opts *PDFOptions) PDFFlagSet {
 		pfs.SetPassword(*opts.Password)
 	}
 
+	if opts.Reproducible != nil {
+		pfs.SetReproducible(*opts.Reproducible)
+	}
+
 	if opts.SmartShrinking != nil {
 		pfs.SetSmartShrinking(*opts.SmartShrinking)
 	}
@@ -219,7 +243,12 @@ func NewPDFFlagSetFromOptions(opts *PDFOptions) PDFFlagSet {
 func (pfs *PDFFlagSet) Flags() []string {
 	var flags []string
 
-	for flagKey, flagValue := range *pfs {
+	for _, flagKey := range sortedFlagKeys(flagSet(*pfs)) {
+		if checkStringSliceContains(postProcessKeys, flagKey) {
+			continue
+		}
+
+		flagValue := (*pfs)[flagKey]
 		switch flagValue.(type) {
 		case int:
 			evaluateIntFlag(&flags, flagKey, flagValue.(int))
@@ -248,6 +277,7 @@ func (pfs *PDFFlagSet) Flags() []string {
 				"forms",
 				"internal-links",
 				"javascript",
+				"local-file-access",
 				"smart-shrinking",
 			}
 
@@ -276,256 +306,231 @@ func (pfs *PDFFlagSet) Flags() []string {
 	return flags
 }
 
+// Has reports whether a flag is set in a PDFFlagSet
+func (pfs *PDFFlagSet) Has(key string) bool {
+	_, exists := (*pfs)[key]
+
+	return exists
+}
+
+// Unset removes a flag from a PDFFlagSet
+func (pfs *PDFFlagSet) Unset(key string) {
+	delete(*pfs, key)
+}
+
+// Clone returns a deep copy of a PDFFlagSet
+func (pfs *PDFFlagSet) Clone() PDFFlagSet {
+	return cloneFlagSet(*pfs)
+}
+
+// Equal reports whether two PDFFlagSets hold the same flags and values
+func (pfs *PDFFlagSet) Equal(other PDFFlagSet) bool {
+	return equalFlagSets(*pfs, other)
+}
+
+// GetAllow retrieves the Allow from a PDFFlagSet
+func (pfs *PDFFlagSet) GetAllow() ([]string, bool) {
+	return getFlag[[]string](*pfs, "allow")
+}
+
 // GetCacheDir retrieves the CacheDir from a PDFFlagSet
 func (pfs *PDFFlagSet) GetCacheDir() (string, bool) {
-	dir, exists := (*pfs)["cache-dir"]
-
-	return dir.(string), exists
+	return getFlag[string](*pfs, "cache-dir")
 }
 
 // GetCookie retrieves the Cookie from a PDFFlagSet
 func (pfs *PDFFlagSet) GetCookie() ([]CookieSet, bool) {
-	cookies, exists := (*pfs)["cookie"]
-
-	return cookies.([]CookieSet), exists
+	return getFlag[[]CookieSet](*pfs, "cookie")
 }
 
 // GetCustomHeader retrieves the CustomHeader from a PDFFlagSet
 func (pfs *PDFFlagSet) GetCustomHeader() ([]HeaderSet, bool) {
-	headers, exists := (*pfs)["custom-header"]
-
-	return headers.([]HeaderSet), exists
+	return getFlag[[]HeaderSet](*pfs, "custom-header")
 }
 
 // GetCustomHeaderPropagation retrieves the CustomHeaderPropagation from a PDFFlagSet
 func (pfs *PDFFlagSet) GetCustomHeaderPropagation() (bool, bool) {
-	value, exists := (*pfs)["custom-header-propagation"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "custom-header-propagation")
 }
 
 // GetDebugJavascript retrieves the DebugJavascript from a PDFFlagSet
 func (pfs *PDFFlagSet) GetDebugJavascript() (bool, bool) {
-	value, exists := (*pfs)["debug-javascript"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "debug-javascript")
 }
 
 // GetDPI retrieves the DPI from a PDFFlagSet
 func (pfs *PDFFlagSet) GetDPI() (int, bool) {
-	dpi, exists := (*pfs)["dpi"]
-
-	return dpi.(int), exists
+	return getFlag[int](*pfs, "dpi")
 }
 
 // GetEncoding retrieves the Encoding from a PDFFlagSet
 func (pfs *PDFFlagSet) GetEncoding() (string, bool) {
-	encoding, exists := (*pfs)["encoding"]
-
-	return encoding.(string), exists
+	return getFlag[string](*pfs, "encoding")
 }
 
 // GetExternalLinks retrieves the ExternalLinks from a PDFFlagSet
 func (pfs *PDFFlagSet) GetExternalLinks() (bool, bool) {
-	value, exists := (*pfs)["external-links"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "external-links")
 }
 
 // GetForms retrieves the Forms from a PDFFlagSet
 func (pfs *PDFFlagSet) GetForms() (bool, bool) {
-	value, exists := (*pfs)["forms"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "forms")
 }
 
 // GetGrayscale retrieves the Grayscale from a PDFFlagSet
 func (pfs *PDFFlagSet) GetGrayscale() (bool, bool) {
-	value, exists := (*pfs)["grayscale"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "grayscale")
 }
 
 // GetImages retrieves the Images from a PDFFlagSet
 func (pfs *PDFFlagSet) GetImages() (bool, bool) {
-	value, exists := (*pfs)["images"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "images")
 }
 
 // GetImageDPI retrieves the ImageDPI from a PDFFlagSet
 func (pfs *PDFFlagSet) GetImageDPI() (int, bool) {
-	dpi, exists := (*pfs)["image-dpi"]
-
-	return dpi.(int), exists
+	return getFlag[int](*pfs, "image-dpi")
 }
 
 // GetImageQuality retrieves the ImageQuality from a PDFFlagSet
 func (pfs *PDFFlagSet) GetImageQuality() (int, bool) {
-	quality, exists := (*pfs)["image-quality"]
-
-	return quality.(int), exists
+	return getFlag[int](*pfs, "image-quality")
 }
 
 // GetInternalLinks retrieves the InternalLinks from a PDFFlagSet
 func (pfs *PDFFlagSet) GetInternalLinks() (bool, bool) {
-	value, exists := (*pfs)["internal-links"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "internal-links")
 }
 
 // GetJavascript retrieves the Javascript from a PDFFlagSet
 func (pfs *PDFFlagSet) GetJavascript() (bool, bool) {
-	value, exists := (*pfs)["javascript"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "javascript")
 }
 
 // GetJavascriptDelay retrieves the JavascriptDelay from a PDFFlagSet
 func (pfs *PDFFlagSet) GetJavascriptDelay() (int, bool) {
-	milliseconds, exists := (*pfs)["javascript-delay"]
-
-	return milliseconds.(int), exists
+	return getFlag[int](*pfs, "javascript-delay")
 }
 
 // GetLoadErrorHandling retrieves the LoadErrorHandling from a PDFFlagSet
 func (pfs *PDFFlagSet) GetLoadErrorHandling() (string, bool) {
-	handling, exists := (*pfs)["load-error-handling"]
-
-	return handling.(string), exists
+	return getFlag[string](*pfs, "load-error-handling")
 }
 
 // GetLoadMediaErrorHandling retrieves the LoadMediaErrorHandling from a PDFFlagSet
 func (pfs *PDFFlagSet) GetLoadMediaErrorHandling() (string, bool) {
-	handling, exists := (*pfs)["load-media-error-handling"]
+	return getFlag[string](*pfs, "load-media-error-handling")
+}
 
-	return handling.(string), exists
+// GetLocalFileAccess retrieves the LocalFileAccess from a PDFFlagSet
+func (pfs *PDFFlagSet) GetLocalFileAccess() (bool, bool) {
+	return getFlag[bool](*pfs, "local-file-access")
 }
 
 // GetLowQuality retrieves the LowQuality from a PDFFlagSet
 func (pfs *PDFFlagSet) GetLowQuality() (bool, bool) {
-	value, exists := (*pfs)["lowquality"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "lowquality")
 }
 
 // GetMarginBottom retrieves the MarginBottom from a PDFFlagSet
 func (pfs *PDFFlagSet) GetMarginBottom() (int, bool) {
-	millimetres, exists := (*pfs)["margin-bottom"]
-
-	return millimetres.(int), exists
+	return getFlag[int](*pfs, "margin-bottom")
 }
 
 // GetMarginLeft retrieves the MarginLeft from a PDFFlagSet
 func (pfs *PDFFlagSet) GetMarginLeft() (int, bool) {
-	millimetres, exists := (*pfs)["margin-left"]
-
-	return millimetres.(int), exists
+	return getFlag[int](*pfs, "margin-left")
 }
 
 // GetMarginRight retrieves the MarginRight from a PDFFlagSet
 func (pfs *PDFFlagSet) GetMarginRight() (int, bool) {
-	millimetres, exists := (*pfs)["margin-right"]
-
-	return millimetres.(int), exists
+	return getFlag[int](*pfs, "margin-right")
 }
 
 // GetMarginTop retrieves the MarginTop from a PDFFlagSet
 func (pfs *PDFFlagSet) GetMarginTop() (int, bool) {
-	millimetres, exists := (*pfs)["margin-top"]
+	return getFlag[int](*pfs, "margin-top")
+}
 
-	return millimetres.(int), exists
+// GetMetadata retrieves the Metadata from a PDFFlagSet
+func (pfs *PDFFlagSet) GetMetadata() (PDFMetadata, bool) {
+	return getFlag[PDFMetadata](*pfs, "metadata")
 }
 
 // GetMinimumFontSize retrieves the MinimumFontSize from a PDFFlagSet
 func (pfs *PDFFlagSet) GetMinimumFontSize() (int, bool) {
-	size, exists := (*pfs)["minimum-font-size"]
-
-	return size.(int), exists
+	return getFlag[int](*pfs, "minimum-font-size")
 }
 
 // GetNoPDFCompression retrieves the NoPDFCompression from a PDFFlagSet
 func (pfs *PDFFlagSet) GetNoPDFCompression() (bool, bool) {
-	value, exists := (*pfs)["no-pdf-compression"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "no-pdf-compression")
 }
 
 // GetOrientation retrieves the Orientation from a PDFFlagSet
 func (pfs *PDFFlagSet) GetOrientation() (string, bool) {
-	orientation, exists := (*pfs)["orientation"]
-
-	return orientation.(string), exists
+	return getFlag[string](*pfs, "orientation")
 }
 
 // GetPageHeight retrieves the PageHeight from a PDFFlagSet
 func (pfs *PDFFlagSet) GetPageHeight() (int, bool) {
-	height, exists := (*pfs)["page-height"]
-
-	return height.(int), exists
+	return getFlag[int](*pfs, "page-height")
 }
 
 // GetPageSize retrieves the PageSize from a PDFFlagSet
 func (pfs *PDFFlagSet) GetPageSize() (string, bool) {
-	size, exists := (*pfs)["page-size"]
-
-	return size.(string), exists
+	return getFlag[string](*pfs, "page-size")
 }
 
 // GetPageWidth retrieves the PageWidth from a PDFFlagSet
 func (pfs *PDFFlagSet) GetPageWidth() (int, bool) {
-	width, exists := (*pfs)["page-width"]
-
-	return width.(int), exists
+	return getFlag[int](*pfs, "page-width")
 }
 
 // GetPassword retrieves the Password from a PDFFlagSet
 func (pfs *PDFFlagSet) GetPassword() (string, bool) {
-	password, exists := (*pfs)["password"]
+	return getFlag[string](*pfs, "password")
+}
 
-	return password.(string), exists
+// GetReproducible retrieves the Reproducible from a PDFFlagSet
+func (pfs *PDFFlagSet) GetReproducible() (bool, bool) {
+	return getFlag[bool](*pfs, "reproducible")
 }
 
 // GetSmartShrinking retrieves the SmartShrinking from a PDFFlagSet
 func (pfs *PDFFlagSet) GetSmartShrinking() (bool, bool) {
-	value, exists := (*pfs)["smart-width"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "smart-shrinking")
 }
 
 // GetStopSlowScripts retrieves the StopSlowScripts from a PDFFlagSet
 func (pfs *PDFFlagSet) GetStopSlowScripts() (bool, bool) {
-	value, exists := (*pfs)["stop-slow-scripts"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "stop-slow-scripts")
 }
 
 // GetTitle retrieves the Title from a PDFFlagSet
 func (pfs *PDFFlagSet) GetTitle() (string, bool) {
-	title, exists := (*pfs)["title"]
-
-	return title.(string), exists
+	return getFlag[string](*pfs, "title")
 }
 
 // GetUseXServer retrieves the UseXServer from a PDFFlagSet
 func (pfs *PDFFlagSet) GetUseXServer() (bool, bool) {
-	value, exists := (*pfs)["use-xserver"]
-
-	return value.(bool), exists
+	return getFlag[bool](*pfs, "use-xserver")
 }
 
 // GetUsername retrieves the Username from a PDFFlagSet
 func (pfs *PDFFlagSet) GetUsername() (string, bool) {
-	username, exists := (*pfs)["username"]
-
-	return username.(string), exists
+	return getFlag[string](*pfs, "username")
 }
 
 // GetZoom retrieves the Zoom from a PDFFlagSet
 func (pfs *PDFFlagSet) GetZoom() (float64, bool) {
-	zoom, exists := (*pfs)["zoom"]
+	return getFlag[float64](*pfs, "zoom")
+}
 
-	return zoom.(float64), exists
+// SetAllow sets the Allow of a PDFFlagSet
+func (pfs *PDFFlagSet) SetAllow(dirs []string) {
+	(*pfs)["allow"] = dirs
 }
 
 // SetCacheDir sets the CacheDir of a PDFFlagSet
@@ -618,6 +623,11 @@ func (pfs *PDFFlagSet) SetLoadMediaErrorHandling(handling string) {
 	(*pfs)["load-media-error-handling"] = handling
 }
 
+// SetLocalFileAccess sets the LocalFileAccess of a PDFFlagSet
+func (pfs *PDFFlagSet) SetLocalFileAccess(value bool) {
+	(*pfs)["local-file-access"] = value
+}
+
 // SetLowQuality sets the LowQuality of a PDFFlagSet
 func (pfs *PDFFlagSet) SetLowQuality(value bool) {
 	(*pfs)["lowquality"] = value
@@ -643,6 +653,13 @@ func (pfs *PDFFlagSet) SetMarginTop(millimetres int) {
 	(*pfs)["margin-top"] = millimetres
 }
 
+// SetMetadata sets the document information written into the PDF generated
+// from a PDFFlagSet. It is applied after conversion and is not passed to
+// wkhtmltopdf.
+func (pfs *PDFFlagSet) SetMetadata(meta PDFMetadata) {
+	(*pfs)["metadata"] = cloneFlagValue(meta)
+}
+
 // SetMinimumFontSize sets the MinimumFontSize of a PDFFlagSet
 func (pfs *PDFFlagSet) SetMinimumFontSize(size int) {
 	(*pfs)["minimum-font-size"] = size
@@ -678,9 +695,16 @@ func (pfs *PDFFlagSet) SetPassword(password string) {
 	(*pfs)["password"] = password
 }
 
+// SetReproducible sets whether the PDF generated from a PDFFlagSet is
+// rewritten so that the same input always gives the same bytes. It is applied
+// after conversion and is not passed to wkhtmltopdf.
+func (pfs *PDFFlagSet) SetReproducible(value bool) {
+	(*pfs)["reproducible"] = value
+}
+
 // SetSmartShrinking sets the SmartShrinking of a PDFFlagSet
 func (pfs *PDFFlagSet) SetSmartShrinking(value bool) {
-	(*pfs)["smart-width"] = value
+	(*pfs)["smart-shrinking"] = value
 }
 
 // SetStopSlowScripts sets the StopSlowScripts of a PDFFlagSet
@@ -710,7 +734,12 @@ func (pfs *PDFFlagSet) SetZoom(zoom float64) {
 
 // Generate performs the PDF conversion and saves the file to disk
 func (pfs *PDFFlagSet) Generate(inputURL string, outputFile string) ([]byte, error) {
-	out, err := runConversionCommand(pdfConverterBinary, pfs.Flags(), &inputURL, &outputFile)
+	return pfs.GenerateContext(context.Background(), nil, inputURL, outputFile)
+}
 
-	return out, err
+// GenerateContext performs the PDF conversion using ex, or DefaultExecutor
+// if ex is nil, and saves the file to disk. The PDF is written to a temporary
+// file and renamed to outputFile only if it is well formed.
+func (pfs *PDFFlagSet) GenerateContext(ctx context.Context, ex Executor, inputURL string, outputFile string) ([]byte, error) {
+	return generateFile(ctx, ex, newOutputCheck(PDFConverter, flagSet(*pfs)), URLSource{URL: inputURL}, outputFile, pfs.Command)
 }
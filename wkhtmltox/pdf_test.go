@@ -245,6 +245,22 @@ func TestPDFFlagSetFlags(t *testing.T) {
 		t.Fatalf("expected '%s' but got '%s'", expected, got)
 	}
 
+	pfs = make(wkhtmltox.PDFFlagSet)
+	pfs["local-file-access"] = false
+	expected = []string{"--disable-local-file-access"}
+	got = pfs.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
+	pfs = make(wkhtmltox.PDFFlagSet)
+	pfs["allow"] = []string{"/some/dir", "/other/dir"}
+	expected = []string{"--allow", "/some/dir", "--allow", "/other/dir"}
+	got = pfs.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+
 	pfs = make(wkhtmltox.PDFFlagSet)
 	pfs["javascript-delay"] = 200
 	expected = []string{"--javascript-delay", "200"}
@@ -450,6 +466,107 @@ func TestPDFFlagSetFlags(t *testing.T) {
 	if !reflect.DeepEqual(expected, got) {
 		t.Fatalf("expected '%s' but got '%s'", expected, got)
 	}
+
+	pfs = make(wkhtmltox.PDFFlagSet)
+	pfs["grayscale"] = true
+	pfs["metadata"] = wkhtmltox.PDFMetadata{Author: "Finance"}
+	pfs["reproducible"] = true
+	expected = []string{"--grayscale"}
+	got = pfs.Flags()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%s' but got '%s'", expected, got)
+	}
+}
+
+func TestPDFFlagSetHas(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs["zoom"] = 1.5
+
+	if !pfs.Has("zoom") {
+		t.Fatalf("expected %s to be set", "zoom")
+	}
+
+	if pfs.Has("encoding") {
+		t.Fatalf("expected %s not to be set", "encoding")
+	}
+}
+
+func TestPDFFlagSetUnset(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs["zoom"] = 1.5
+	pfs.Unset("zoom")
+
+	if _, exists := pfs["zoom"]; exists {
+		t.Fatalf("expected %s to be unset, got %v", "zoom", pfs["zoom"])
+	}
+}
+
+func TestPDFFlagSetClone(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs["cookie"] = []wkhtmltox.CookieSet{
+		wkhtmltox.CookieSet{
+			Name:  "cookie1",
+			Value: "value1",
+		},
+	}
+	clone := pfs.Clone()
+
+	if !pfs.Equal(clone) {
+		t.Fatalf("expected clone '%v' to equal '%v'", clone, pfs)
+	}
+
+	clone["cookie"].([]wkhtmltox.CookieSet)[0].Value = "changed"
+	clone["zoom"] = 1.5
+	if pfs["cookie"].([]wkhtmltox.CookieSet)[0].Value != "value1" || pfs.Has("zoom") {
+		t.Fatalf("expected original to be unaffected by changes to clone, got '%v'", pfs)
+	}
+}
+
+func TestPDFFlagSetEqual(t *testing.T) {
+	a := make(wkhtmltox.PDFFlagSet)
+	a["encoding"] = "utf-8"
+	b := make(wkhtmltox.PDFFlagSet)
+	b["encoding"] = "utf-8"
+
+	if !a.Equal(b) {
+		t.Fatalf("expected '%v' to equal '%v'", a, b)
+	}
+
+	b["encoding"] = "latin-1"
+	if a.Equal(b) {
+		t.Fatalf("expected '%v' not to equal '%v'", a, b)
+	}
+
+	delete(b, "encoding")
+	b["zoom"] = 1.5
+	if a.Equal(b) {
+		t.Fatalf("expected '%v' not to equal '%v'", a, b)
+	}
+}
+
+func TestPDFFlagSetGetWhenAbsent(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+
+	if value, exists := pfs.GetCacheDir(); exists || value != "" {
+		t.Fatalf("expected %s to be absent, got %q", "cache-dir", value)
+	}
+
+	pfs["zoom"] = "1.5"
+	if value, exists := pfs.GetZoom(); exists || value != 0 {
+		t.Fatalf("expected %s of the wrong type to be reported absent, got %v", "zoom", value)
+	}
+}
+
+func TestPDFFlagSetGetAllow(t *testing.T) {
+	attribute := "allow"
+	dirs := []string{"/tmp/xyz"}
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs[attribute] = dirs
+	result, exists := pfs.GetAllow()
+
+	if !exists || !reflect.DeepEqual(result, dirs) {
+		t.Fatalf("expected %s to be %s, got %s", attribute, dirs, result)
+	}
 }
 
 func TestPDFFlagSetGetCacheDir(t *testing.T) {
@@ -686,6 +803,18 @@ func TestPDFFlagSetGetLoadMediaErrorHandling(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetGetLocalFileAccess(t *testing.T) {
+	attribute := "local-file-access"
+	value := false
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs[attribute] = value
+	result, exists := pfs.GetLocalFileAccess()
+
+	if !exists || result != value {
+		t.Fatalf("expected %s to be %t, got %t", attribute, value, result)
+	}
+}
+
 func TestPDFFlagSetGetLowQuality(t *testing.T) {
 	attribute := "lowquality"
 	value := true
@@ -746,6 +875,18 @@ func TestPDFFlagSetGetMarginTop(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetGetMetadata(t *testing.T) {
+	attribute := "metadata"
+	value := wkhtmltox.PDFMetadata{Author: "Finance"}
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs["metadata"] = value
+	result, exists := pfs.GetMetadata()
+
+	if !exists || result.Author != value.Author {
+		t.Fatalf("expected %s to be %v, got %v", attribute, value, result)
+	}
+}
+
 func TestPDFFlagSetGetMinimumFontSize(t *testing.T) {
 	attribute := "minimum-font-size"
 	size := 12
@@ -830,11 +971,23 @@ func TestPDFFlagSetGetPassword(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetGetReproducible(t *testing.T) {
+	attribute := "reproducible"
+	value := true
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs["reproducible"] = value
+	result, exists := pfs.GetReproducible()
+
+	if !exists || result != value {
+		t.Fatalf("expected %s to be %t, got %t", attribute, value, result)
+	}
+}
+
 func TestPDFFlagSetGetSmartShrinking(t *testing.T) {
-	attribute := "smart-width"
+	attribute := "smart-shrinking"
 	value := true
 	pfs := make(wkhtmltox.PDFFlagSet)
-	pfs["smart-width"] = value
+	pfs["smart-shrinking"] = value
 	result, exists := pfs.GetSmartShrinking()
 
 	if !exists || result != value {
@@ -902,6 +1055,17 @@ func TestPDFFlagSetGetZoom(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetSetAllow(t *testing.T) {
+	attribute := "allow"
+	dirs := []string{"/tmp/xyz"}
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetAllow(dirs)
+
+	if !reflect.DeepEqual(pfs[attribute], dirs) {
+		t.Fatalf("expected %s to be %s, got %s", attribute, dirs, pfs[attribute])
+	}
+}
+
 func TestPDFFlagSetSetCacheDir(t *testing.T) {
 	attribute := "cache-dir"
 	dir := "/tmp/xyz"
@@ -1118,6 +1282,17 @@ func TestPDFFlagSetSetLoadMediaErrorHandling(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetSetLocalFileAccess(t *testing.T) {
+	attribute := "local-file-access"
+	value := false
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetLocalFileAccess(value)
+
+	if pfs[attribute] != value {
+		t.Fatalf("expected %s to be %t, got %t", attribute, value, pfs[attribute])
+	}
+}
+
 func TestPDFFlagSetSetLowQuality(t *testing.T) {
 	attribute := "lowquality"
 	value := true
@@ -1173,6 +1348,30 @@ func TestPDFFlagSetSetMarginTop(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetSetMetadata(t *testing.T) {
+	attribute := "metadata"
+	value := wkhtmltox.PDFMetadata{Author: "Finance", Custom: map[string]string{"Retention": "7y"}}
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetMetadata(value)
+	value.Custom["Retention"] = "1y"
+
+	result, _ := pfs.GetMetadata()
+	if result.Author != "Finance" || result.Custom["Retention"] != "7y" {
+		t.Fatalf("expected %s to be a copy, got %v", attribute, result)
+	}
+
+	clone := pfs.Clone()
+	cloned, _ := clone.GetMetadata()
+	cloned.Custom["Retention"] = "1y"
+	if result.Custom["Retention"] != "7y" {
+		t.Fatalf("expected the clone to have its own %s", attribute)
+	}
+
+	if flags := pfs.Flags(); len(flags) != 0 {
+		t.Fatalf("expected no converter flags, got %v", flags)
+	}
+}
+
 func TestPDFFlagSetSetMinimumFontSize(t *testing.T) {
 	attribute := "minimum-font-size"
 	size := 12
@@ -1250,8 +1449,23 @@ func TestPDFFlagSetSetPassword(t *testing.T) {
 	}
 }
 
+func TestPDFFlagSetSetReproducible(t *testing.T) {
+	attribute := "reproducible"
+	value := true
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetReproducible(value)
+
+	if pfs[attribute] != value {
+		t.Fatalf("expected %s to be %t, got %t", attribute, value, pfs[attribute])
+	}
+
+	if flags := pfs.Flags(); len(flags) != 0 {
+		t.Fatalf("expected no converter flags, got %v", flags)
+	}
+}
+
 func TestPDFFlagSetSetSmartShrinking(t *testing.T) {
-	attribute := "smart-width"
+	attribute := "smart-shrinking"
 	value := true
 	pfs := make(wkhtmltox.PDFFlagSet)
 	pfs.SetSmartShrinking(value)
@@ -1259,6 +1473,11 @@ func TestPDFFlagSetSetSmartShrinking(t *testing.T) {
 	if pfs[attribute] != value {
 		t.Fatalf("expected %s to be %t, got %t", attribute, value, pfs[attribute])
 	}
+
+	pfs.SetSmartShrinking(false)
+	if flags := pfs.Flags(); len(flags) != 1 || flags[0] != "--disable-smart-shrinking" {
+		t.Fatalf("expected --disable-smart-shrinking, got %v", flags)
+	}
 }
 
 func TestPDFFlagSetSetStopSlowScripts(t *testing.T) {
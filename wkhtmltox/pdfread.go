@@ -0,0 +1,851 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDFInfo describes a PDF document
+type PDFInfo struct {
+	Pages        int        // Number of pages
+	PageSizes    []PageSize // Size of each page, in order
+	Title        string
+	Author       string
+	Subject      string
+	Keywords     string
+	Creator      string
+	Producer     string
+	CreationDate time.Time         // Zero if absent or unparseable
+	ModDate      time.Time         // Zero if absent or unparseable
+	Info         map[string]string // Every text entry of the Info dictionary, including the above
+}
+
+// PageSize is the size of a page in points, 1/72 of an inch, as displayed,
+// with any rotation applied
+type PageSize struct {
+	Width  float64
+	Height float64
+}
+
+// PDFSyntaxError is returned when a PDF cannot be read
+type PDFSyntaxError struct {
+	Offset int // Byte offset the problem was found at
+	Reason string
+}
+
+func (e *PDFSyntaxError) Error() string {
+	return fmt.Sprintf("wkhtmltox: malformed PDF at offset %d: %s", e.Offset, e.Reason)
+}
+
+// ReadPDFInfo reads the page count, page sizes and Info dictionary of a PDF.
+// It understands the cross-reference tables and uncompressed objects that
+// wkhtmltopdf writes, and recovers from wrong offsets by scanning for
+// objects, but not cross-reference or object streams.
+func ReadPDFInfo(data []byte) (*PDFInfo, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &PDFInfo{Info: make(map[string]string)}
+	if err := f.readInfo(info); err != nil {
+		return nil, err
+	}
+
+	root, err := f.resolveDict(f.trailer["Root"])
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, &PDFSyntaxError{Offset: f.trailerOffset, Reason: "trailer has no /Root catalog"}
+	}
+
+	err = f.walkPages(root["Pages"], pageAttrs{}, make(map[pdfRef]bool), func(size PageSize) {
+		info.PageSizes = append(info.PageSizes, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.Pages = len(info.PageSizes)
+
+	return info, nil
+}
+
+func (f *pdfFile) readInfo(info *PDFInfo) error {
+	dict, err := f.resolveDict(f.trailer["Info"])
+	if err != nil || dict == nil {
+		return err
+	}
+
+	for key, value := range dict {
+		value, err := f.resolve(value)
+		if err != nil {
+			return err
+		}
+		if s, ok := value.(pdfString); ok {
+			info.Info[string(key)] = s.text()
+		}
+	}
+
+	info.Title = info.Info["Title"]
+	info.Author = info.Info["Author"]
+	info.Subject = info.Info["Subject"]
+	info.Keywords = info.Info["Keywords"]
+	info.Creator = info.Info["Creator"]
+	info.Producer = info.Info["Producer"]
+	info.CreationDate, _ = parsePDFDate(info.Info["CreationDate"])
+	info.ModDate, _ = parsePDFDate(info.Info["ModDate"])
+
+	return nil
+}
+
+// pageAttrs are the page attributes inherited down the page tree
+type pageAttrs struct {
+	mediaBox pdfArray
+	rotate   int
+}
+
+// walkPages calls page with the size of every page below node, in order
+func (f *pdfFile) walkPages(node pdfObject, inherited pageAttrs, seen map[pdfRef]bool, page func(PageSize)) error {
+	if ref, ok := node.(pdfRef); ok {
+		if seen[ref] {
+			return &PDFSyntaxError{Offset: f.objects[ref.num].offset, Reason: "page tree has a cycle"}
+		}
+		seen[ref] = true
+	}
+
+	dict, err := f.resolveDict(node)
+	if err != nil {
+		return err
+	}
+	if dict == nil {
+		return &PDFSyntaxError{Reason: "page tree node is not a dictionary"}
+	}
+
+	attrs := inherited
+	if box, err := f.resolve(dict["MediaBox"]); err != nil {
+		return err
+	} else if box, ok := box.(pdfArray); ok {
+		attrs.mediaBox = box
+	}
+	if rotate, err := f.resolve(dict["Rotate"]); err != nil {
+		return err
+	} else if rotate, ok := rotate.(int); ok {
+		attrs.rotate = rotate
+	}
+
+	kids, err := f.resolve(dict["Kids"])
+	if err != nil {
+		return err
+	}
+	if dict["Type"] == pdfName("Page") || kids == nil {
+		page(f.pageSize(attrs))
+		return nil
+	}
+
+	kidsArray, ok := kids.(pdfArray)
+	if !ok {
+		return &PDFSyntaxError{Reason: "page tree /Kids is not an array"}
+	}
+	for _, kid := range kidsArray {
+		if err := f.walkPages(kid, attrs, seen, page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *pdfFile) pageSize(attrs pageAttrs) PageSize {
+	var box [4]float64
+	if len(attrs.mediaBox) == 4 {
+		for i, v := range attrs.mediaBox {
+			v, _ := f.resolve(v)
+			box[i], _ = pdfNumber(v)
+		}
+	}
+
+	size := PageSize{Width: math.Abs(box[2] - box[0]), Height: math.Abs(box[3] - box[1])}
+	if ((attrs.rotate%360)+360)%180 == 90 {
+		size.Width, size.Height = size.Height, size.Width
+	}
+
+	return size
+}
+
+// pdfDatePattern matches dates such as D:20170101120000+03'00'
+var pdfDatePattern = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:([Zz])|([+-])(\d{2})'?(\d{2})?'?)?`)
+
+// parsePDFDate parses a PDF date string
+func parsePDFDate(s string) (time.Time, error) {
+	m := pdfDatePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, fmt.Errorf("wkhtmltox: %q is not a PDF date", s)
+	}
+
+	part := func(i int, fallback int) int {
+		if m[i] == "" {
+			return fallback
+		}
+		n, _ := strconv.Atoi(m[i])
+		return n
+	}
+
+	loc := time.UTC
+	if m[8] != "" {
+		offset := part(9, 0)*3600 + part(10, 0)*60
+		if m[8] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+
+	return time.Date(part(1, 0), time.Month(part(2, 1)), part(3, 1), part(4, 0), part(5, 0), part(6, 0), 0, loc), nil
+}
+
+// PDF objects, as parsed. Numbers are int or float64, booleans bool and null
+// nil.
+type (
+	pdfObject interface{}
+	pdfName   string
+	pdfString []byte
+	pdfArray  []pdfObject
+	pdfDict   map[pdfName]pdfObject
+	pdfRef    struct{ num, gen int }
+	pdfStream struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+// text decodes a text string, which is UTF-16BE if it starts with a byte
+// order mark, UTF-8 if it starts with one, and PDFDocEncoding, approximated
+// by Latin-1, otherwise
+func (s pdfString) text() string {
+	switch {
+	case bytes.HasPrefix(s, []byte("\xfe\xff")):
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case bytes.HasPrefix(s, []byte("\xef\xbb\xbf")):
+		return string(s[3:])
+	}
+
+	runes := make([]rune, len(s))
+	for i, b := range s {
+		runes[i] = rune(b)
+	}
+
+	return string(runes)
+}
+
+func pdfNumber(obj pdfObject) (float64, bool) {
+	switch n := obj.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// pdfXrefEntry locates an object in use
+type pdfXrefEntry struct {
+	offset int
+	gen    int
+}
+
+// pdfFile is a parsed PDF, whose objects are read as they are needed
+type pdfFile struct {
+	data          []byte
+	objects       map[int]pdfXrefEntry
+	trailer       pdfDict
+	trailerOffset int
+}
+
+// startxrefWindow is how far from the end of a PDF startxref is looked for
+const startxrefWindow = 2048
+
+var objectHeaderPattern = regexp.MustCompile(`(?m)(?:^|[\r\n])\s*(\d+)\s+(\d+)\s+obj\b`)
+
+func parsePDF(data []byte) (*pdfFile, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, &PDFSyntaxError{Reason: "missing %PDF- header"}
+	}
+
+	f := &pdfFile{data: data, objects: make(map[int]pdfXrefEntry)}
+	if err := f.readXref(); err != nil || !f.xrefValid() {
+		if err := f.scanObjects(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// readXref reads the cross-reference table that startxref points at, and
+// the tables before it
+func (f *pdfFile) readXref() error {
+	tail := f.data[max(0, len(f.data)-startxrefWindow):]
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return &PDFSyntaxError{Offset: len(f.data), Reason: "missing startxref"}
+	}
+
+	lx := &pdfLexer{data: f.data, pos: len(f.data) - len(tail) + i + len("startxref")}
+	offset, ok := lx.token().(int)
+	seen := make(map[int]bool)
+	for ok {
+		if seen[offset] {
+			return &PDFSyntaxError{Offset: offset, Reason: "cross-reference tables form a cycle"}
+		}
+		seen[offset] = true
+
+		trailer, err := f.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if f.trailer == nil {
+			f.trailer = trailer
+		}
+
+		offset, ok = trailer["Prev"].(int)
+	}
+
+	if f.trailer == nil {
+		return &PDFSyntaxError{Offset: len(f.data), Reason: "startxref is not a number"}
+	}
+
+	return nil
+}
+
+// readXrefSection reads the table at offset into f.objects, without
+// overriding entries from newer tables, and returns its trailer
+func (f *pdfFile) readXrefSection(offset int) (pdfDict, error) {
+	if offset < 0 || offset >= len(f.data) {
+		return nil, &PDFSyntaxError{Offset: offset, Reason: "startxref is out of range"}
+	}
+
+	lx := &pdfLexer{data: f.data, pos: offset}
+	if lx.token() != pdfKeyword("xref") {
+		return nil, &PDFSyntaxError{Offset: offset, Reason: "expected a cross-reference table"}
+	}
+
+	for {
+		start := lx.pos
+		first := lx.token()
+		if first == pdfKeyword("trailer") {
+			f.trailerOffset = start
+			trailer, ok := lx.object().(pdfDict)
+			if !ok || lx.err != nil {
+				return nil, &PDFSyntaxError{Offset: start, Reason: "malformed trailer"}
+			}
+			return trailer, nil
+		}
+
+		firstNum, ok1 := first.(int)
+		count, ok2 := lx.token().(int)
+		if !ok1 || !ok2 {
+			return nil, &PDFSyntaxError{Offset: start, Reason: "malformed cross-reference subsection"}
+		}
+
+		for num := firstNum; num < firstNum+count; num++ {
+			entryOffset, ok1 := lx.token().(int)
+			gen, ok2 := lx.token().(int)
+			kind := lx.token()
+			if !ok1 || !ok2 || (kind != pdfKeyword("n") && kind != pdfKeyword("f")) {
+				return nil, &PDFSyntaxError{Offset: lx.pos, Reason: "malformed cross-reference entry"}
+			}
+
+			if _, exists := f.objects[num]; !exists && kind == pdfKeyword("n") {
+				f.objects[num] = pdfXrefEntry{offset: entryOffset, gen: gen}
+			}
+		}
+	}
+}
+
+// xrefValid reports whether every entry points at the object it names
+func (f *pdfFile) xrefValid() bool {
+	for num, entry := range f.objects {
+		lx := &pdfLexer{data: f.data, pos: entry.offset}
+		if entry.offset < 0 || entry.offset >= len(f.data) || lx.token() != num || lx.token() != entry.gen || lx.token() != pdfKeyword("obj") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scanObjects rebuilds f.objects and f.trailer by searching the file, for
+// PDFs whose cross-reference table is missing or wrong
+func (f *pdfFile) scanObjects() error {
+	f.objects = make(map[int]pdfXrefEntry)
+	for _, m := range objectHeaderPattern.FindAllSubmatchIndex(f.data, -1) {
+		num, _ := strconv.Atoi(string(f.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(f.data[m[4]:m[5]]))
+		f.objects[num] = pdfXrefEntry{offset: m[2], gen: gen}
+	}
+
+	i := bytes.LastIndex(f.data, []byte("trailer"))
+	if i < 0 {
+		return &PDFSyntaxError{Offset: len(f.data), Reason: "missing trailer"}
+	}
+
+	lx := &pdfLexer{data: f.data, pos: i + len("trailer")}
+	trailer, ok := lx.object().(pdfDict)
+	if !ok || lx.err != nil {
+		return &PDFSyntaxError{Offset: i, Reason: "malformed trailer"}
+	}
+	f.trailer, f.trailerOffset = trailer, i
+
+	return nil
+}
+
+// object reads object num, returning the value and the offset just after
+// its endobj
+func (f *pdfFile) object(num int) (pdfObject, int, error) {
+	return f.readObject(num, true)
+}
+
+// readObject reads object num, resolving indirect stream lengths only if
+// lengths is set, so that a length can never lead back to its own stream
+func (f *pdfFile) readObject(num int, lengths bool) (pdfObject, int, error) {
+	entry, ok := f.objects[num]
+	if !ok {
+		return nil, 0, nil
+	}
+
+	lx := &pdfLexer{data: f.data, pos: entry.offset}
+	if lengths {
+		lx.file = f
+	}
+	if lx.token() != num || lx.token() != entry.gen || lx.token() != pdfKeyword("obj") {
+		return nil, 0, &PDFSyntaxError{Offset: entry.offset, Reason: fmt.Sprintf("object %d is not where the cross-reference table says", num)}
+	}
+
+	obj := lx.object()
+	if dict, ok := obj.(pdfDict); ok && lx.err == nil {
+		if stream, isStream := lx.stream(dict); isStream {
+			obj = stream
+		}
+	}
+	if lx.err != nil {
+		return nil, 0, lx.err
+	}
+
+	end := lx.pos
+	if lx.token() == pdfKeyword("endobj") {
+		end = lx.pos
+	}
+
+	return obj, end, nil
+}
+
+// resolve follows obj if it is a reference. Missing objects are null.
+func (f *pdfFile) resolve(obj pdfObject) (pdfObject, error) {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj, nil
+		}
+
+		var err error
+		if obj, _, err = f.object(ref.num); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, &PDFSyntaxError{Reason: "references nest too deeply"}
+}
+
+// resolveDict resolves obj to a dictionary, or the dictionary of a stream,
+// returning nil if it is neither
+func (f *pdfFile) resolveDict(obj pdfObject) (pdfDict, error) {
+	obj, err := f.resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := obj.(type) {
+	case pdfDict:
+		return v, nil
+	case pdfStream:
+		return v.dict, nil
+	}
+
+	return nil, nil
+}
+
+// pdfKeyword is a bare word such as obj, R or trailer
+type pdfKeyword string
+
+// pdfLexer reads tokens and objects from data. The first error is kept in
+// err, after which everything reads as nil.
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	file  *pdfFile // Resolves indirect stream lengths, if set
+	depth int
+	err   error
+}
+
+// maxPDFNesting bounds how deeply arrays and dictionaries may nest
+const maxPDFNesting = 64
+
+func isPDFSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\f' || b == 0
+}
+
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte("()<>[]{}/%", b) >= 0
+}
+
+func (lx *pdfLexer) fail(reason string) {
+	if lx.err == nil {
+		lx.err = &PDFSyntaxError{Offset: lx.pos, Reason: reason}
+	}
+}
+
+func (lx *pdfLexer) skipSpace() {
+	for lx.pos < len(lx.data) {
+		switch b := lx.data[lx.pos]; {
+		case isPDFSpace(b):
+			lx.pos++
+		case b == '%':
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\r' && lx.data[lx.pos] != '\n' {
+				lx.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads a number, keyword, name, string or delimiter such as "[" or
+// "<<", returned as a pdfKeyword
+func (lx *pdfLexer) token() pdfObject {
+	lx.skipSpace()
+	if lx.err != nil || lx.pos >= len(lx.data) {
+		lx.fail("unexpected end of file")
+		return nil
+	}
+
+	switch b := lx.data[lx.pos]; b {
+	case '(':
+		return lx.literalString()
+	case '/':
+		lx.pos++
+		return pdfName(lx.name())
+	case '[', ']', '{', '}':
+		lx.pos++
+		return pdfKeyword(b)
+	case '<', '>':
+		if lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == b {
+			lx.pos += 2
+			return pdfKeyword([]byte{b, b})
+		}
+		if b == '<' {
+			return lx.hexString()
+		}
+		lx.pos++
+		lx.fail("unexpected >")
+		return nil
+	}
+
+	start := lx.pos
+	for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelimiter(lx.data[lx.pos]) {
+		lx.pos++
+	}
+	word := string(lx.data[start:lx.pos])
+
+	if n, err := strconv.Atoi(word); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f
+	}
+
+	return pdfKeyword(word)
+}
+
+func (lx *pdfLexer) name() string {
+	var buf []byte
+	for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelimiter(lx.data[lx.pos]) {
+		b := lx.data[lx.pos]
+		if b == '#' && lx.pos+2 < len(lx.data) {
+			if v, err := strconv.ParseUint(string(lx.data[lx.pos+1:lx.pos+3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				lx.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, b)
+		lx.pos++
+	}
+
+	return string(buf)
+}
+
+func (lx *pdfLexer) literalString() pdfObject {
+	lx.pos++ // (
+	var buf []byte
+	nesting := 0
+
+	for lx.pos < len(lx.data) {
+		b := lx.data[lx.pos]
+		lx.pos++
+
+		switch b {
+		case '(':
+			nesting++
+		case ')':
+			if nesting == 0 {
+				return pdfString(buf)
+			}
+			nesting--
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				break
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			case 'b':
+				b = '\b'
+			case 'f':
+				b = '\f'
+			case '\r':
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; i++ {
+						v = v*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					b = byte(v)
+				} else {
+					b = e
+				}
+			}
+		}
+		buf = append(buf, b)
+	}
+
+	lx.fail("unterminated string")
+	return nil
+}
+
+func (lx *pdfLexer) hexString() pdfObject {
+	lx.pos++ // <
+	var digits []byte
+	for lx.pos < len(lx.data) && lx.data[lx.pos] != '>' {
+		if b := lx.data[lx.pos]; !isPDFSpace(b) {
+			digits = append(digits, b)
+		}
+		lx.pos++
+	}
+	if lx.pos >= len(lx.data) {
+		lx.fail("unterminated hex string")
+		return nil
+	}
+	lx.pos++ // >
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	buf := make([]byte, len(digits)/2)
+	for i := range buf {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			lx.fail("malformed hex string")
+			return nil
+		}
+		buf[i] = byte(v)
+	}
+
+	return pdfString(buf)
+}
+
+// object reads a value, including references such as 3 0 R
+func (lx *pdfLexer) object() pdfObject {
+	tok := lx.token()
+
+	switch v := tok.(type) {
+	case int:
+		// Look ahead for "gen R"
+		save := lx.pos
+		if gen, ok := lx.token().(int); ok && lx.token() == pdfKeyword("R") {
+			return pdfRef{num: v, gen: gen}
+		}
+		lx.pos, lx.err = save, nil
+		return v
+	case pdfKeyword:
+		switch v {
+		case "[":
+			return lx.array()
+		case "<<":
+			return lx.dict()
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		lx.fail(fmt.Sprintf("unexpected %q", string(v)))
+		return nil
+	}
+
+	return tok
+}
+
+func (lx *pdfLexer) array() pdfObject {
+	if lx.depth++; lx.depth > maxPDFNesting {
+		lx.fail("objects nest too deeply")
+		return nil
+	}
+	defer func() { lx.depth-- }()
+
+	arr := pdfArray{}
+	for lx.err == nil {
+		lx.skipSpace()
+		if lx.pos < len(lx.data) && lx.data[lx.pos] == ']' {
+			lx.pos++
+			return arr
+		}
+		arr = append(arr, lx.object())
+	}
+
+	return nil
+}
+
+func (lx *pdfLexer) dict() pdfObject {
+	if lx.depth++; lx.depth > maxPDFNesting {
+		lx.fail("objects nest too deeply")
+		return nil
+	}
+	defer func() { lx.depth-- }()
+
+	dict := pdfDict{}
+	for lx.err == nil {
+		key := lx.token()
+		if key == pdfKeyword(">>") {
+			return dict
+		}
+
+		name, ok := key.(pdfName)
+		if !ok {
+			lx.fail("dictionary key is not a name")
+			return nil
+		}
+		dict[name] = lx.object()
+	}
+
+	return nil
+}
+
+// stream reads the data of a stream with the dictionary dict, if one
+// follows. A /Length that is wrong or cannot be resolved is recovered from
+// by looking for endstream.
+func (lx *pdfLexer) stream(dict pdfDict) (pdfStream, bool) {
+	save := lx.pos
+	if lx.token() != pdfKeyword("stream") {
+		lx.pos, lx.err = save, nil
+		return pdfStream{}, false
+	}
+
+	if lx.pos < len(lx.data) && lx.data[lx.pos] == '\r' {
+		lx.pos++
+	}
+	if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+		lx.pos++
+	}
+	start := lx.pos
+
+	length := -1
+	switch v := dict["Length"].(type) {
+	case int:
+		length = v
+	case pdfRef:
+		if lx.file != nil {
+			if n, _, err := lx.file.readObject(v.num, false); err == nil {
+				if n, ok := n.(int); ok {
+					length = n
+				}
+			}
+		}
+	}
+
+	if length >= 0 && start+length <= len(lx.data) {
+		end := &pdfLexer{data: lx.data, pos: start + length}
+		if end.token() == pdfKeyword("endstream") {
+			lx.pos = end.pos
+			return pdfStream{dict: dict, data: lx.data[start : start+length]}, true
+		}
+	}
+
+	// Without a usable length the data ends at the first endstream keyword
+	// that is followed by endobj, since the data may contain the keyword
+	i := -1
+	for from := start; ; {
+		next := bytes.Index(lx.data[from:], []byte("endstream"))
+		if next < 0 {
+			break
+		}
+		if i < 0 {
+			i = from + next - start
+		}
+		end := &pdfLexer{data: lx.data, pos: from + next + len("endstream")}
+		if end.token() == pdfKeyword("endobj") {
+			i = from + next - start
+			break
+		}
+		from += next + len("endstream")
+	}
+	if i < 0 {
+		lx.fail("unterminated stream")
+		return pdfStream{}, false
+	}
+	data := bytes.TrimRight(lx.data[start:start+i], "\r\n")
+	lx.pos = start + i + len("endstream")
+
+	return pdfStream{dict: dict, data: data}, true
+}
@@ -0,0 +1,140 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+// buildPDF lays out objects, numbered from 1, with a cross-reference table
+// and the given trailer entries
+func buildPDF(trailer string, objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+
+	return buf.Bytes()
+}
+
+// qtPDF is laid out the way wkhtmltopdf's Qt writer lays out documents: the
+// Info dictionary first with UTF-16 strings, indirect stream lengths and
+// page sizes inherited from the page tree
+var qtPDF = buildPDF("/Info 1 0 R /Root 2 0 R",
+	"<<\n/Title (\\376\\377\\000R\\000\\351\\000p\\000o\\000r\\000t)\n/Creator <FEFF0077006B00680074006D006C0074006F007000640066>\n/Producer (Qt 4.8.7)\n/CreationDate (D:20170102030405+03'00')\n>>",
+	"<<\n/Type /Catalog\n/Pages 3 0 R\n>>",
+	"<<\n/Type /Pages\n/Kids [\n4 0 R\n5 0 R\n]\n/Count 2\n/MediaBox [0 0 595 842]\n>>",
+	"<<\n/Type /Page\n/Parent 3 0 R\n/Contents 6 0 R\n>>",
+	"<<\n/Type /Page\n/Parent 3 0 R\n/Rotate 90\n/Contents 6 0 R\n>>",
+	"<<\n/Length 7 0 R\n>>\nstream\nq endstream Q\nendstream",
+	"12",
+)
+
+func TestReadPDFInfo(t *testing.T) {
+	info, err := wkhtmltox.ReadPDFInfo(qtPDF)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if info.Pages != 2 || info.PageSizes[0] != (wkhtmltox.PageSize{Width: 595, Height: 842}) || info.PageSizes[1] != (wkhtmltox.PageSize{Width: 842, Height: 595}) {
+		t.Fatalf("unexpected pages %d %v", info.Pages, info.PageSizes)
+	}
+
+	if info.Title != "Réport" || info.Creator != "wkhtmltopdf" || info.Producer != "Qt 4.8.7" || info.Info["Producer"] != "Qt 4.8.7" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	if expected := time.Date(2017, 1, 2, 0, 4, 5, 0, time.UTC); !info.CreationDate.Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, info.CreationDate)
+	}
+}
+
+func TestReadPDFInfoRecovers(t *testing.T) {
+	// Offsets that are all wrong, as when a PDF is edited by hand
+	shifted := bytes.Replace(qtPDF, []byte("%PDF-1.4\n"), []byte("%PDF-1.4\n% an extra comment\n"), 1)
+
+	// An incremental update that retitles the document
+	updated := append([]byte(nil), qtPDF...)
+	prev := bytes.LastIndex(updated, []byte("startxref"))
+	offset := len(updated)
+	updated = append(updated, "8 0 obj\n<< /Title (Revised) >>\nendobj\n"...)
+	xref := len(updated)
+	updated = append(updated, fmt.Sprintf("xref\n8 1\n%010d 00000 n \ntrailer\n<< /Size 9 /Info 8 0 R /Root 2 0 R /Prev %s >>\nstartxref\n%d\n%%%%EOF\n",
+		offset, strings.Fields(string(updated[prev:]))[1], xref)...)
+
+	for name, tc := range map[string]struct {
+		data  []byte
+		title string
+	}{
+		"wrong offsets":      {shifted, "Réport"},
+		"incremental update": {updated, "Revised"},
+	} {
+		info, err := wkhtmltox.ReadPDFInfo(tc.data)
+		if err != nil || info.Pages != 2 || info.Title != tc.title {
+			t.Fatalf("%s: unexpected info %+v (%v)", name, info, err)
+		}
+	}
+}
+
+func TestReadPDFInfoMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"not a pdf":      []byte("<html></html>"),
+		"truncated":      qtPDF[:len(qtPDF)/2],
+		"no catalog":     buildPDF("", "<< /Type /Catalog >>"),
+		"page tree loop": buildPDF("/Root 1 0 R", "<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [2 0 R] >>"),
+	} {
+		var syntaxErr *wkhtmltox.PDFSyntaxError
+		if _, err := wkhtmltox.ReadPDFInfo(data); !errors.As(err, &syntaxErr) {
+			t.Fatalf("%s: expected a PDFSyntaxError, got %v", name, err)
+		}
+	}
+}
+
+func TestLocalRendererPDFInfo(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	title := "Quarterly (draft)"
+
+	result, err := wkhtmltox.LocalRenderer{}.PDF(context.Background(), "http://example.com", &wkhtmltox.PDFOptions{Title: &title})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.PDF == nil || result.PDF.Pages != 1 || result.PDF.Title != title || result.PDF.PageSizes[0].Height != 842 {
+		t.Fatalf("unexpected PDF info %+v", result.PDF)
+	}
+}
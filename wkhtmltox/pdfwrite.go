@@ -0,0 +1,381 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// errUnsupportedPDF is returned when a PDF uses features that rewriting
+// would lose
+var errUnsupportedPDF = errors.New("wkhtmltox: cannot rewrite PDFs that are encrypted or use cross-reference or object streams")
+
+// MakePDFReproducible rewrites a PDF so that converting the same input with
+// the same options always gives the same bytes. The creation and
+// modification dates and the document ID are removed, and the objects are
+// laid out afresh with a new cross-reference table.
+func MakePDFReproducible(data []byte) ([]byte, error) {
+	return pdfRewrite{reproducible: true}.apply(data)
+}
+
+// PDFMetadata represents entries of the document information dictionary of
+// a PDF. Empty fields leave the entry as it is.
+type PDFMetadata struct {
+	Title    string            `json:"title,omitempty"`
+	Author   string            `json:"author,omitempty"`
+	Subject  string            `json:"subject,omitempty"`
+	Keywords string            `json:"keywords,omitempty"`
+	Creator  string            `json:"creator,omitempty"`
+	Producer string            `json:"producer,omitempty"`
+	Custom   map[string]string `json:"custom,omitempty"` // Other entries by key, removed if the value is empty
+}
+
+// entries adds the entries of m to info and returns it
+// clone returns a copy of m that shares no map with it
+func (m PDFMetadata) clone() interface{} {
+	if m.Custom != nil {
+		m.Custom = maps.Clone(m.Custom)
+	}
+
+	return m
+}
+
+func (m PDFMetadata) entries(info map[string]string) map[string]string {
+	if info == nil {
+		info = make(map[string]string)
+	}
+
+	for key, value := range m.Custom {
+		info[key] = value
+	}
+	for key, value := range map[string]string{
+		"Title":    m.Title,
+		"Author":   m.Author,
+		"Subject":  m.Subject,
+		"Keywords": m.Keywords,
+		"Creator":  m.Creator,
+		"Producer": m.Producer,
+	} {
+		if value != "" {
+			info[key] = value
+		}
+	}
+
+	return info
+}
+
+// SetPDFMetadata copies the PDF read from in to out with the document
+// information set from meta. Everything else is kept, including the document
+// ID, but earlier revisions of the document are dropped.
+func SetPDFMetadata(in io.Reader, out io.Writer, meta PDFMetadata) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	if data, err = (pdfRewrite{info: meta.entries(nil)}).apply(data); err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// postProcessKeys are the PDFFlagSet keys that describe how the generated PDF
+// is rewritten rather than wkhtmltopdf flags, so Flags leaves them out
+var postProcessKeys = []string{
+	"metadata",
+	"reproducible",
+}
+
+// pdfRewrite describes changes made to a generated PDF
+type pdfRewrite struct {
+	reproducible bool              // Remove dates and the document ID
+	info         map[string]string // Info entries to set, removed if empty
+}
+
+// newPDFRewrite returns the changes pfs asks for. Reproducible PDFs also
+// take their title from pfs, so its encoding does not depend on the
+// converter. Metadata takes precedence over that title.
+func newPDFRewrite(pfs PDFFlagSet) pdfRewrite {
+	var rw pdfRewrite
+
+	rw.reproducible, _ = pfs.GetReproducible()
+	if title, ok := pfs.GetTitle(); ok && rw.reproducible {
+		rw.info = map[string]string{"Title": title}
+	}
+	if meta, ok := pfs.GetMetadata(); ok {
+		rw.info = meta.entries(rw.info)
+	}
+
+	return rw
+}
+
+func (rw pdfRewrite) needed() bool {
+	return rw.reproducible || len(rw.info) > 0
+}
+
+func (rw pdfRewrite) apply(data []byte) ([]byte, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := f.resolveDict(f.trailer["Info"])
+	if err != nil {
+		return nil, err
+	}
+
+	info := pdfDict{}
+	for key, value := range original {
+		if info[key], err = f.resolve(value); err != nil {
+			return nil, err
+		}
+	}
+
+	if rw.reproducible {
+		delete(info, "CreationDate")
+		delete(info, "ModDate")
+	}
+	for key, value := range rw.info {
+		if key == "" {
+			return nil, errors.New("wkhtmltox: PDF metadata keys cannot be empty")
+		}
+
+		if value == "" {
+			delete(info, pdfName(key))
+		} else {
+			info[pdfName(key)] = encodePDFText(value)
+		}
+	}
+
+	return f.rewrite(info, rw.reproducible)
+}
+
+// encodePDFText encodes a text string as ASCII if it can be, and as UTF-16BE
+// with a byte order mark otherwise
+func encodePDFText(s string) pdfString {
+	ascii := true
+	for _, r := range s {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return pdfString(s)
+	}
+
+	buf := []byte{0xfe, 0xff}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		buf = append(buf, byte(unit>>8), byte(unit))
+	}
+
+	return pdfString(buf)
+}
+
+// rewrite lays out every object in use in order of number, copying each as
+// it is except for the Info dictionary, which is replaced by info, and
+// writes a new cross-reference table and trailer. The document ID is
+// dropped if dropID is set.
+func (f *pdfFile) rewrite(info pdfDict, dropID bool) ([]byte, error) {
+	if _, encrypted := f.trailer["Encrypt"]; encrypted {
+		return nil, errUnsupportedPDF
+	}
+
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	infoNum := 1
+	if len(nums) > 0 {
+		infoNum = nums[len(nums)-1] + 1
+	}
+	if ref, ok := f.trailer["Info"].(pdfRef); ok {
+		if _, exists := f.objects[ref.num]; exists {
+			infoNum = ref.num
+		}
+	}
+	if _, exists := f.objects[infoNum]; !exists {
+		nums = append(nums, infoNum)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(pdfHeader(f.data))
+
+	offsets := make(map[int]int, len(nums))
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+
+		if num == infoNum {
+			fmt.Fprintf(&buf, "%d 0 obj\n", num)
+			writePDFObject(&buf, info)
+			buf.WriteString("\nendobj\n")
+			continue
+		}
+
+		obj, end, err := f.object(num)
+		if err != nil {
+			return nil, err
+		}
+		if stream, ok := obj.(pdfStream); ok && (stream.dict["Type"] == pdfName("ObjStm") || stream.dict["Type"] == pdfName("XRef")) {
+			return nil, errUnsupportedPDF
+		}
+
+		raw := bytes.TrimRight(f.data[f.objects[num].offset:end], " \t\r\n")
+		buf.Write(raw)
+		if !bytes.HasSuffix(raw, []byte("endobj")) {
+			buf.WriteString("\nendobj")
+		}
+		buf.WriteString("\n")
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for i := 0; i < len(nums); {
+		// A subsection for each run of consecutive numbers
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(&buf, "%d %d\n", nums[i], j-i)
+		for _, num := range nums[i:j] {
+			gen := 0
+			if num != infoNum {
+				gen = f.objects[num].gen
+			}
+			fmt.Fprintf(&buf, "%010d %05d n \n", offsets[num], gen)
+		}
+		i = j
+	}
+
+	trailer := pdfDict{}
+	for key, value := range f.trailer {
+		switch key {
+		case "Prev", "XRefStm":
+			continue
+		case "ID":
+			if dropID {
+				continue
+			}
+		}
+		trailer[key] = value
+	}
+	trailer["Size"] = nums[len(nums)-1] + 1
+	trailer["Info"] = pdfRef{num: infoNum}
+
+	buf.WriteString("trailer\n")
+	writePDFObject(&buf, trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return buf.Bytes(), nil
+}
+
+// writePDFObject serializes obj, with dictionary keys in order so that the
+// output is stable
+func writePDFObject(buf *bytes.Buffer, obj pdfObject) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case pdfName:
+		buf.WriteByte('/')
+		for i := 0; i < len(v); i++ {
+			if b := v[i]; b <= ' ' || b >= 0x7f || b == '#' || isPDFDelimiter(b) {
+				fmt.Fprintf(buf, "#%02X", b)
+			} else {
+				buf.WriteByte(b)
+			}
+		}
+	case pdfString:
+		// Binary strings such as IDs and UTF-16 text are written in hex
+		if bytes.ContainsFunc(v, func(r rune) bool { return r < ' ' || r >= 0x7f }) {
+			fmt.Fprintf(buf, "<%X>", []byte(v))
+			break
+		}
+		buf.WriteByte('(')
+		for _, b := range v {
+			if b == '(' || b == ')' || b == '\\' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(b)
+		}
+		buf.WriteByte(')')
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("<<")
+		for _, key := range keys {
+			buf.WriteByte(' ')
+			writePDFObject(buf, pdfName(key))
+			buf.WriteByte(' ')
+			writePDFObject(buf, v[pdfName(key)])
+		}
+		buf.WriteString(" >>")
+	default:
+		// Streams cannot be written inline
+		buf.WriteString("null")
+	}
+}
+
+// pdfHeader returns the leading comment lines of data, the version and the
+// binary marker
+func pdfHeader(data []byte) []byte {
+	end := 0
+	for end < len(data) && data[end] == '%' {
+		next := bytes.IndexAny(data[end:], "\r\n")
+		if next < 0 {
+			break
+		}
+		end += next
+		for end < len(data) && (data[end] == '\r' || data[end] == '\n') {
+			end++
+		}
+	}
+
+	return data[:end]
+}
@@ -0,0 +1,293 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+// checkXref checks that every entry of the only cross-reference table in
+// data points at the object it names
+func checkXref(t *testing.T, data []byte) {
+	t.Helper()
+
+	var xref int
+	tail := string(data[bytes.LastIndex(data, []byte("startxref")):])
+	if _, err := fmt.Sscanf(tail, "startxref\n%d", &xref); err != nil {
+		t.Fatalf("expected startxref, got %q", tail)
+	}
+
+	lines := strings.Split(string(data[xref:]), "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("expected a cross-reference table at %d, got %q", xref, lines[0])
+	}
+
+	for i := 1; i < len(lines) && lines[i] != "trailer"; {
+		var first, count int
+		fmt.Sscanf(lines[i], "%d %d", &first, &count)
+		for num := first; num < first+count; num++ {
+			var offset, gen int
+			var kind string
+			fmt.Sscanf(lines[i+1+num-first], "%d %d %s", &offset, &gen, &kind)
+			if kind == "n" && !bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d %d obj", num, gen))) {
+				t.Fatalf("expected object %d at offset %d", num, offset)
+			}
+		}
+		i += count + 1
+	}
+}
+
+func TestMakePDFReproducible(t *testing.T) {
+	dated := func(date string, id string) []byte {
+		data := bytes.Replace(qtPDF, []byte("D:20170102030405+03'00'"), []byte(date), 1)
+		return bytes.Replace(data, []byte("/Root 2 0 R"), []byte("/Root 2 0 R /ID [<"+id+"> <"+id+">]"), 1)
+	}
+
+	first, err := wkhtmltox.MakePDFReproducible(dated("D:20200101000000Z", "aa"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	second, _ := wkhtmltox.MakePDFReproducible(dated("D:20210606060606Z", "bbbb"))
+
+	if !bytes.Equal(first, second) {
+		t.Fatalf("expected the same bytes, got\n%s\nand\n%s", first, second)
+	}
+	checkXref(t, first)
+
+	if !bytes.Contains(first, []byte("stream\nq endstream Q\nendstream")) {
+		t.Fatalf("expected the content stream to be copied whole, got\n%s", first)
+	}
+
+	if bytes.Contains(first, []byte("/ID")) || bytes.Contains(first, []byte("CreationDate")) {
+		t.Fatalf("expected the ID and dates to be removed, got\n%s", first)
+	}
+
+	info, err := wkhtmltox.ReadPDFInfo(first)
+	if err != nil || info.Pages != 2 || info.Title != "Réport" || info.Producer != "Qt 4.8.7" || !info.CreationDate.IsZero() {
+		t.Fatalf("unexpected info %+v (%v)", info, err)
+	}
+}
+
+func TestMakePDFReproducibleFlattensUpdates(t *testing.T) {
+	data := append([]byte(nil), qtPDF...)
+	prev := bytes.LastIndex(data, []byte("startxref"))
+	offset := len(data)
+	data = append(data, "1 0 obj\n<< /Title (Revised) >>\nendobj\n"...)
+	xref := len(data)
+	data = append(data, fmt.Sprintf("xref\n1 1\n%010d 00000 n \ntrailer\n<< /Size 8 /Info 1 0 R /Root 2 0 R /Prev %s >>\nstartxref\n%d\n%%%%EOF\n",
+		offset, strings.Fields(string(data[prev:]))[1], xref)...)
+
+	out, err := wkhtmltox.MakePDFReproducible(data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	checkXref(t, out)
+
+	if bytes.Count(out, []byte("trailer")) != 1 || bytes.Contains(out, []byte("/Prev")) || bytes.Contains(out, []byte("Qt 4.8.7")) {
+		t.Fatalf("expected a single revision, got\n%s", out)
+	}
+
+	if info, err := wkhtmltox.ReadPDFInfo(out); err != nil || info.Title != "Revised" {
+		t.Fatalf("unexpected info %+v (%v)", info, err)
+	}
+}
+
+func TestMakePDFReproducibleEncrypted(t *testing.T) {
+	encrypted := bytes.Replace(qtPDF, []byte("/Root 2 0 R"), []byte("/Root 2 0 R /Encrypt 7 0 R"), 1)
+
+	if _, err := wkhtmltox.MakePDFReproducible(encrypted); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestReproducibleRenders(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	title := "Archive ✓"
+	reproducible := true
+	hash := func(opts *wkhtmltox.PDFOptions) [sha256.Size]byte {
+		result, err := wkhtmltox.LocalRenderer{}.PDF(context.Background(), "http://example.com", opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		checkXref(t, result.Data)
+		return sha256.Sum256(result.Data)
+	}
+
+	if hash(&wkhtmltox.PDFOptions{Title: &title}) == hash(&wkhtmltox.PDFOptions{Title: &title}) {
+		t.Fatal("expected plain renders to differ")
+	}
+
+	opts := &wkhtmltox.PDFOptions{Title: &title, Reproducible: &reproducible}
+	if hash(opts) != hash(opts) {
+		t.Fatal("expected reproducible renders to be identical")
+	}
+
+	dir := t.TempDir()
+	var files [2][]byte
+	for i := range files {
+		output := filepath.Join(dir, fmt.Sprintf("%d.pdf", i))
+		job, _ := wkhtmltox.NewPDFJob("http://example.com", output, opts)
+		if _, err := job.Generate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		files[i], _ = os.ReadFile(output)
+	}
+
+	if !bytes.Equal(files[0], files[1]) {
+		t.Fatal("expected reproducible jobs to write identical files")
+	}
+
+	if info, err := wkhtmltox.ReadPDFInfo(files[0]); err != nil || info.Title != title {
+		t.Fatalf("expected the title from the options, got %+v (%v)", info, err)
+	}
+}
+
+func TestSetPDFMetadata(t *testing.T) {
+	in := bytes.Replace(qtPDF, []byte("/Root 2 0 R"), []byte("/Root 2 0 R /ID [<aa> <aa>]"), 1)
+	meta := wkhtmltox.PDFMetadata{
+		Author:   "Zoë Example",
+		Keywords: "invoice, 2017",
+		Custom:   map[string]string{"Department": "Finance", "CreationDate": ""},
+	}
+
+	var out bytes.Buffer
+	if err := wkhtmltox.SetPDFMetadata(bytes.NewReader(in), &out, meta); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	checkXref(t, out.Bytes())
+
+	info, err := wkhtmltox.ReadPDFInfo(out.Bytes())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if info.Title != "Réport" || info.Creator != "wkhtmltopdf" || info.Author != meta.Author || info.Keywords != meta.Keywords || info.Info["Department"] != "Finance" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	if !info.CreationDate.IsZero() || !bytes.Contains(out.Bytes(), []byte("/ID [<AA> <AA>]")) {
+		t.Fatalf("expected the creation date to be removed and the ID kept, got\n%s", out.Bytes())
+	}
+}
+
+func TestSetPDFMetadataWithoutInfo(t *testing.T) {
+	in := buildPDF("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	)
+
+	var out bytes.Buffer
+	if err := wkhtmltox.SetPDFMetadata(bytes.NewReader(in), &out, wkhtmltox.PDFMetadata{Subject: "Minutes"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	checkXref(t, out.Bytes())
+
+	if info, err := wkhtmltox.ReadPDFInfo(out.Bytes()); err != nil || info.Pages != 1 || info.Subject != "Minutes" {
+		t.Fatalf("unexpected info %+v (%v)", info, err)
+	}
+}
+
+func TestSetPDFMetadataErrors(t *testing.T) {
+	var out bytes.Buffer
+	if err := wkhtmltox.SetPDFMetadata(bytes.NewReader(qtPDF), &out, wkhtmltox.PDFMetadata{Custom: map[string]string{"": "x"}}); err == nil {
+		t.Fatal("expected an error for an empty key")
+	}
+
+	if err := wkhtmltox.SetPDFMetadata(strings.NewReader("not a pdf"), &out, wkhtmltox.PDFMetadata{Author: "x"}); err == nil {
+		t.Fatal("expected an error for a malformed PDF")
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %q", out.Bytes())
+	}
+}
+
+func TestReproducibleGenerate(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	generate := func(pfs wkhtmltox.PDFFlagSet, name string) []byte {
+		output := filepath.Join(dir, name)
+		if _, err := pfs.Generate("http://example.com", output); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		data, _ := os.ReadFile(output)
+		return data
+	}
+
+	plain := make(wkhtmltox.PDFFlagSet)
+	if bytes.Equal(generate(plain, "a.pdf"), generate(plain, "b.pdf")) {
+		t.Fatal("expected plain PDFs to differ")
+	}
+
+	reproducible := true
+	pfs := wkhtmltox.NewPDFFlagSetFromOptions(&wkhtmltox.PDFOptions{Reproducible: &reproducible})
+	first, second := generate(pfs, "c.pdf"), generate(pfs, "d.pdf")
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected reproducible PDFs to be identical")
+	}
+
+	if bytes.Contains(first, []byte("/ID")) || bytes.Contains(first, []byte("CreationDate")) {
+		t.Fatalf("expected the ID and dates to be removed, got\n%s", first)
+	}
+}
+
+func TestMetadataGenerate(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	output := filepath.Join(t.TempDir(), "out.pdf")
+
+	pfs := wkhtmltox.NewPDFFlagSetFromOptions(&wkhtmltox.PDFOptions{
+		Metadata: &wkhtmltox.PDFMetadata{Author: "Finance", Subject: "Minutes"},
+	})
+	if _, err := pfs.Generate("http://example.com", output); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data, _ := os.ReadFile(output)
+	if info, err := wkhtmltox.ReadPDFInfo(data); err != nil || info.Author != "Finance" || info.Subject != "Minutes" {
+		t.Fatalf("unexpected info %+v (%v)", info, err)
+	}
+}
+
+func TestMetadataRenders(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	title := "Quarterly"
+	opts := &wkhtmltox.PDFOptions{
+		Title:    &title,
+		Metadata: &wkhtmltox.PDFMetadata{Author: "Finance", Custom: map[string]string{"Retention": "7y"}},
+	}
+
+	result, err := wkhtmltox.LocalRenderer{}.PDF(context.Background(), "http://example.com", opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.PDF.Title != title || result.PDF.Author != "Finance" || result.PDF.Info["Retention"] != "7y" || result.PDF.CreationDate.IsZero() {
+		t.Fatalf("unexpected info %+v", result.PDF)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Content types of the image formats wkhtmltoimage writes
+var imageContentTypes = map[string]string{
+	"bmp":  "image/bmp",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"svg":  "image/svg+xml",
+}
+
+// ImageContentType returns the media type of an image format, such as
+// "image/png" for "png", or "" if wkhtmltoimage cannot write it
+func ImageContentType(format string) string {
+	return imageContentTypes[strings.ToLower(format)]
+}
+
+// Result is a rendered document
+type Result struct {
+	Data        []byte   // Rendered document
+	ContentType string   // Media type of Data
+	Warnings    []string // Warnings printed by the converter
+	PDF         *PDFInfo // Pages and document information of a PDF, nil for images
+}
+
+// Renderer renders documents into memory. LocalRenderer runs the installed
+// converters, and the client package implements Renderer on top of the
+// rendering service, so either can be used wherever a Renderer is expected.
+type Renderer interface {
+	PDF(ctx context.Context, inputURL string, opts *PDFOptions) (*Result, error)
+	Image(ctx context.Context, inputURL string, opts *ImageOptions) (*Result, error)
+}
+
+// LocalRenderer is a Renderer that runs the installed converters
+type LocalRenderer struct {
+	Executor Executor // How to run converters, nil for DefaultExecutor
+	TempDir  string   // Where outputs are staged, os.TempDir() if empty
+
+	// BlankThreshold is the share of an image, between 0 and 1, that may be
+	// the background color before the image is reported as blank. Zero skips
+	// the check.
+	BlankThreshold float64
+}
+
+// PDF renders inputURL to a PDF
+func (lr LocalRenderer) PDF(ctx context.Context, inputURL string, opts *PDFOptions) (*Result, error) {
+	return lr.PDFSource(ctx, URLSource{URL: inputURL}, opts)
+}
+
+// Image renders inputURL to an image, a PNG unless opts sets another Format
+func (lr LocalRenderer) Image(ctx context.Context, inputURL string, opts *ImageOptions) (*Result, error) {
+	return lr.ImageSource(ctx, URLSource{URL: inputURL}, opts)
+}
+
+// PDFSource renders src to a PDF
+func (lr LocalRenderer) PDFSource(ctx context.Context, src InputSource, opts *PDFOptions) (*Result, error) {
+	if opts == nil {
+		opts = &PDFOptions{}
+	}
+
+	check := newOutputCheck(PDFConverter, flagSet(NewPDFFlagSetFromOptions(opts)))
+
+	return lr.render(ctx, check, ".pdf", "application/pdf", src, func(inputURL string, output string) (Job, error) {
+		return NewPDFJob(inputURL, output, opts)
+	})
+}
+
+// ImageSource renders src to an image, a PNG unless opts sets another Format
+func (lr LocalRenderer) ImageSource(ctx context.Context, src InputSource, opts *ImageOptions) (*Result, error) {
+	format := "png"
+	if opts != nil && opts.Format != nil {
+		format = strings.ToLower(*opts.Format)
+	}
+
+	contentType := ImageContentType(format)
+	if contentType == "" {
+		return nil, fmt.Errorf("wkhtmltox: unsupported image format %q", format)
+	}
+
+	withFormat := ImageOptions{}
+	if opts != nil {
+		withFormat = *opts
+	}
+	withFormat.Format = &format
+
+	check := newOutputCheck(ImageConverter, flagSet(NewImageFlagSetFromOptions(&withFormat)))
+	check.blankThreshold = lr.BlankThreshold
+
+	return lr.render(ctx, check, "."+format, contentType, src, func(inputURL string, output string) (Job, error) {
+		return NewImageJob(inputURL, output, &withFormat)
+	})
+}
+
+// render converts src into memory using the Job built by newJob
+func (lr LocalRenderer) render(ctx context.Context, check outputCheck, ext string, contentType string, src InputSource, newJob func(inputURL string, output string) (Job, error)) (*Result, error) {
+	sink := &BufferSink{TempDir: lr.TempDir}
+	out, err := generateTo(ctx, lr.Executor, check, src, sink, ext, func(inputURL string, outputFile string) (Command, error) {
+		job, err := newJob(inputURL, outputFile)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return job.Command()
+	})
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" && ctx.Err() == nil {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	result := &Result{Data: sink.Bytes(), ContentType: contentType, Warnings: ParseWarnings(out)}
+	if check.kind == PDFConverter {
+		if result.PDF, err = ReadPDFInfo(result.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
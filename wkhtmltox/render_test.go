@@ -0,0 +1,86 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestLocalRendererPDF(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{
+		OutputFile: wkhtmltoxtest.PDF(1),
+		Stderr:     []byte("Warning: Failed to load logo.png (ignore)\n"),
+	})
+	r := wkhtmltox.LocalRenderer{Executor: ex}
+
+	result, err := r.PDF(context.Background(), "https://example.com", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if string(result.Data) != string(wkhtmltoxtest.PDF(1)) || result.ContentType != "application/pdf" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if len(result.Warnings) != 1 || result.Warnings[0] != "Failed to load logo.png (ignore)" {
+		t.Fatalf("unexpected warnings %q", result.Warnings)
+	}
+}
+
+func TestLocalRendererImage(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.JPEG(8, 8)})
+	r := wkhtmltox.LocalRenderer{Executor: ex}
+
+	format := "JPG"
+	opts := &wkhtmltox.ImageOptions{Format: &format}
+	result, err := r.Image(context.Background(), "https://example.com", opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.ContentType != "image/jpeg" || *opts.Format != "JPG" {
+		t.Fatalf("unexpected result %+v or modified options", result)
+	}
+
+	args := ex.Calls()[0].Args
+	if args[0] != "--format" || args[1] != "jpg" || !strings.HasSuffix(args[3], ".jpg") {
+		t.Fatalf("unexpected arguments '%s'", args)
+	}
+
+	format = "gif"
+	if _, err := r.Image(context.Background(), "https://example.com", opts); err == nil {
+		t.Fatal("expected an error for an unsupported format")
+	}
+}
+
+func TestLocalRendererExitError(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{ExitCode: 1, Stderr: []byte("HostNotFoundError")})
+	r := wkhtmltox.LocalRenderer{Executor: ex}
+
+	var exitErr *wkhtmltox.ExitError
+	_, err := r.PDF(context.Background(), "https://example.com", nil)
+	if !errors.As(err, &exitErr) || !strings.Contains(err.Error(), "HostNotFoundError") {
+		t.Fatalf("expected an *ExitError with the output, got %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Defaults for zero HTTPSink fields
+const (
+	DefaultUploadRetries = 3
+	DefaultUploadBackoff = time.Second
+)
+
+// OutputSink receives the document a conversion writes. Converters always
+// write to a file, so a sink opened for a conversion names the file to write
+// and then delivers it, or discards it if the conversion failed.
+type OutputSink interface {
+	// Open prepares the sink for a single conversion. ext is the extension
+	// the converter expects its output to have, such as ".pdf".
+	Open(ctx context.Context, ext string) (SinkOutput, error)
+}
+
+// SinkOutput is an OutputSink opened for a single conversion
+type SinkOutput interface {
+	// Path returns the file the converter writes to
+	Path() string
+
+	// Commit delivers the document once the conversion has succeeded
+	Commit(ctx context.Context) error
+
+	// Abort discards the document. It is called after a failed conversion
+	// or Commit, and must be safe to call more than once.
+	Abort() error
+}
+
+// stagedOutput is a SinkOutput that stages the document in a temporary file
+// and hands it to deliver on Commit
+type stagedOutput struct {
+	path    string
+	deliver func(ctx context.Context, path string) error
+}
+
+func stageOutput(dir string, pattern string, deliver func(ctx context.Context, path string) error) (*stagedOutput, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return &stagedOutput{path: f.Name(), deliver: deliver}, nil
+}
+
+func (so *stagedOutput) Path() string {
+	return so.path
+}
+
+func (so *stagedOutput) Commit(ctx context.Context) error {
+	return so.deliver(ctx, so.path)
+}
+
+func (so *stagedOutput) Abort() error {
+	if err := os.Remove(so.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// deliverData reads a staged document, removes it and hands its contents to
+// deliver
+func deliverData(deliver func(ctx context.Context, data []byte) error) func(context.Context, string) error {
+	return func(ctx context.Context, path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		os.Remove(path)
+
+		return deliver(ctx, data)
+	}
+}
+
+// FileSink writes the document to Path. The converter writes to a temporary
+// file beside Path, which is renamed into place only once the conversion has
+// succeeded, so Path never holds a partial document. The temporary file
+// keeps the extension of Path, if it has one, since wkhtmltoimage picks its
+// format from it.
+type FileSink struct {
+	Path string
+	Perm os.FileMode // Permissions of the file, 0644 if zero
+}
+
+// Open implements OutputSink
+func (fsk FileSink) Open(ctx context.Context, ext string) (SinkOutput, error) {
+	target, err := normalizePath("output", fsk.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	perm := fsk.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+
+	dir, base := filepath.Split(target)
+	if targetExt := filepath.Ext(base); targetExt != "" {
+		ext = targetExt
+	}
+
+	return stageOutput(dir, "."+base+"-*"+ext, func(ctx context.Context, path string) error {
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+
+		return os.Rename(path, target)
+	})
+}
+
+// BufferSink keeps the document in memory
+type BufferSink struct {
+	TempDir string // Where the document is staged, os.TempDir() if empty
+
+	mu   sync.Mutex
+	data []byte
+}
+
+// Open implements OutputSink
+func (bs *BufferSink) Open(ctx context.Context, ext string) (SinkOutput, error) {
+	return stageOutput(bs.TempDir, "wkhtmltox-*"+ext, deliverData(func(ctx context.Context, data []byte) error {
+		bs.mu.Lock()
+		defer bs.mu.Unlock()
+
+		bs.data = data
+		return nil
+	}))
+}
+
+// Bytes returns the document written by the last successful conversion
+func (bs *BufferSink) Bytes() []byte {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	return bs.data
+}
+
+// WriterSink copies the document to Writer once the conversion has
+// succeeded
+type WriterSink struct {
+	Writer  io.Writer
+	TempDir string // Where the document is staged, os.TempDir() if empty
+}
+
+// Open implements OutputSink
+func (ws WriterSink) Open(ctx context.Context, ext string) (SinkOutput, error) {
+	return stageOutput(ws.TempDir, "wkhtmltox-*"+ext, deliverData(func(ctx context.Context, data []byte) error {
+		_, err := ws.Writer.Write(data)
+		return err
+	}))
+}
+
+// UploadError is returned when an HTTPSink gives up uploading a document
+type UploadError struct {
+	URL        string // Where the document was being uploaded
+	StatusCode int    // Status of the last response, zero if there was none
+	Attempts   int    // Number of attempts made
+	Err        error  // Error of the last attempt
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("wkhtmltox: uploading to %s failed after %d attempts: %v", e.URL, e.Attempts, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPSink uploads the document with an HTTP PUT, as object stores expect.
+// Network errors, 429 and 5xx responses are retried with exponential
+// backoff; other non-2xx responses fail at once.
+type HTTPSink struct {
+	URL         string
+	Header      http.Header   // Extra request headers, such as authorization or metadata
+	ContentType string        // Detected from the document if empty
+	Client      *http.Client  // nil for http.DefaultClient
+	Retries     int           // Retries after a failed attempt, DefaultUploadRetries if zero
+	Backoff     time.Duration // Wait before the first retry, doubled each time, DefaultUploadBackoff if zero
+	TempDir     string        // Where the document is staged, os.TempDir() if empty
+}
+
+// Open implements OutputSink
+func (hs HTTPSink) Open(ctx context.Context, ext string) (SinkOutput, error) {
+	return stageOutput(hs.TempDir, "wkhtmltox-*"+ext, deliverData(hs.upload))
+}
+
+func (hs HTTPSink) upload(ctx context.Context, data []byte) error {
+	retries := hs.Retries
+	if retries <= 0 {
+		retries = DefaultUploadRetries
+	}
+	backoff := hs.Backoff
+	if backoff <= 0 {
+		backoff = DefaultUploadBackoff
+	}
+
+	uploadErr := &UploadError{URL: hs.URL}
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				uploadErr.Err = ctx.Err()
+				return uploadErr
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+
+		uploadErr.Attempts++
+		retry, err := hs.put(ctx, data, uploadErr)
+		if err == nil {
+			return nil
+		}
+		uploadErr.Err = err
+
+		if !retry {
+			break
+		}
+	}
+
+	return uploadErr
+}
+
+// put makes a single upload attempt, reporting whether a failure is worth
+// retrying
+func (hs HTTPSink) put(ctx context.Context, data []byte, uploadErr *UploadError) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, hs.URL, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+
+	for key, values := range hs.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	contentType := hs.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := hs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	uploadErr.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("server responded %s", resp.Status)
+}
+
+// generateTo opens sink, converts src into it using the command built for
+// each input and output, checks and finishes the document and commits or
+// aborts the output
+func generateTo(ctx context.Context, ex Executor, check outputCheck, src InputSource, sink OutputSink, ext string, command func(inputURL string, outputFile string) (Command, error)) ([]byte, error) {
+	out, err := sink.Open(ctx, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := generateSource(ctx, ex, src, func(inputURL string) (Command, error) {
+		return command(inputURL, out.Path())
+	})
+	if err == nil {
+		err = check.finish(out.Path())
+	}
+	if err == nil {
+		err = out.Commit(ctx)
+	}
+	if err != nil {
+		out.Abort()
+		return logs, err
+	}
+
+	return logs, nil
+}
+
+// GenerateTo performs the image conversion of src using ex, or
+// DefaultExecutor if ex is nil, and delivers the image to sink
+func (ifs *ImageFlagSet) GenerateTo(ctx context.Context, ex Executor, src InputSource, sink OutputSink) ([]byte, error) {
+	check := newOutputCheck(ImageConverter, flagSet(*ifs))
+
+	return generateTo(ctx, ex, check, src, sink, check.ext, ifs.Command)
+}
+
+// GenerateTo performs the PDF conversion of src using ex, or DefaultExecutor
+// if ex is nil, and delivers the PDF to sink
+func (pfs *PDFFlagSet) GenerateTo(ctx context.Context, ex Executor, src InputSource, sink OutputSink) ([]byte, error) {
+	return generateTo(ctx, ex, newOutputCheck(PDFConverter, flagSet(*pfs)), src, sink, ".pdf", pfs.Command)
+}
+
+// generateFile converts src to outputFile through a FileSink, so a failed
+// conversion never replaces outputFile. Output to "-" is checked like any
+// other and then copied to os.Stdout.
+func generateFile(ctx context.Context, ex Executor, check outputCheck, src InputSource, outputFile string, command func(inputURL string, outputFile string) (Command, error)) ([]byte, error) {
+	if outputFile == stdStream {
+		return generateTo(ctx, ex, check, src, WriterSink{Writer: os.Stdout}, check.ext, command)
+	}
+
+	return generateTo(ctx, ex, check, src, FileSink{Path: outputFile}, filepath.Ext(outputFile), command)
+}
@@ -0,0 +1,248 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+var testSource = wkhtmltox.URLSource{URL: "https://example.com"}
+
+func outputArg(ex *wkhtmltoxtest.Executor) string {
+	args := ex.Calls()[0].Args
+	return args[len(args)-1]
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "report.pdf")
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	pfs := wkhtmltox.PDFFlagSet{}
+
+	if _, err := pfs.GenerateTo(context.Background(), ex, testSource, wkhtmltox.FileSink{Path: target, Perm: 0600}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if staged := outputArg(ex); staged == target || filepath.Dir(staged) != dir || filepath.Ext(staged) != ".pdf" {
+		t.Fatalf("expected the converter to write beside the target, got %q", staged)
+	}
+
+	info, err := os.Stat(target)
+	if data, _ := os.ReadFile(target); err != nil || string(data) != string(wkhtmltoxtest.PDF(1)) || info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected file %q, %v", data, err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected only the target to remain, got %d entries", len(entries))
+	}
+}
+
+func TestFileSinkFailure(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "report.pdf")
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: []byte("%PD"), ExitCode: 1})
+	pfs := wkhtmltox.PDFFlagSet{}
+
+	if _, err := pfs.GenerateTo(context.Background(), ex, testSource, wkhtmltox.FileSink{Path: target}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected no partial output, got %d entries", len(entries))
+	}
+}
+
+func TestBufferAndWriterSinks(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(8, 8)})
+	ifs := wkhtmltox.ImageFlagSet{}
+
+	buffer := &wkhtmltox.BufferSink{}
+	if _, err := ifs.GenerateTo(context.Background(), ex, testSource, buffer); err != nil || string(buffer.Bytes()) != string(wkhtmltoxtest.PNG(8, 8)) {
+		t.Fatalf("unexpected buffer %q, %v", buffer.Bytes(), err)
+	}
+
+	if filepath.Ext(outputArg(ex)) != ".png" {
+		t.Fatalf("expected a .png output, got %q", outputArg(ex))
+	}
+	if _, err := os.Stat(outputArg(ex)); !os.IsNotExist(err) {
+		t.Fatalf("expected the staged output to be removed, got %v", err)
+	}
+
+	var w bytes.Buffer
+	if _, err := ifs.GenerateTo(context.Background(), ex, testSource, wkhtmltox.WriterSink{Writer: &w}); err != nil || w.String() != string(wkhtmltoxtest.PNG(8, 8)) {
+		t.Fatalf("unexpected output %q, %v", w.String(), err)
+	}
+}
+
+func TestSinkTempDir(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(8, 8)})
+	ifs := wkhtmltox.ImageFlagSet{}
+	dir := t.TempDir()
+
+	sinks := map[string]wkhtmltox.OutputSink{
+		"buffer": &wkhtmltox.BufferSink{TempDir: dir},
+		"writer": wkhtmltox.WriterSink{Writer: io.Discard, TempDir: dir},
+	}
+	for name, sink := range sinks {
+		if _, err := ifs.GenerateTo(context.Background(), ex, testSource, sink); err != nil {
+			t.Fatalf("expected no error from the %s sink, got %v", name, err)
+		}
+		if filepath.Dir(outputArg(ex)) != dir {
+			t.Fatalf("expected the %s sink to stage in %s, got %s", name, dir, outputArg(ex))
+		}
+	}
+
+	buffer := &wkhtmltox.BufferSink{TempDir: filepath.Join(dir, "missing")}
+	if _, err := ifs.GenerateTo(context.Background(), ex, testSource, buffer); err == nil {
+		t.Fatalf("expected an error staging in a missing directory, got none")
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+
+	f()
+	w.Close()
+
+	return <-done
+}
+
+func TestGenerateToStdout(t *testing.T) {
+	reproducible := true
+	pfs := wkhtmltox.NewPDFFlagSetFromOptions(&wkhtmltox.PDFOptions{
+		Reproducible: &reproducible,
+		Metadata:     &wkhtmltox.PDFMetadata{Author: "Jane"},
+	})
+
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1), Stderr: []byte("Done\n")})
+	var logs []byte
+	var err error
+	data := captureStdout(t, func() {
+		logs, err = pfs.GenerateContext(context.Background(), ex, "https://example.com", "-")
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if outputArg(ex) == "-" || bytes.Contains(logs, []byte("%PDF")) {
+		t.Fatalf("expected the PDF to be staged and kept out of the logs, got '%s' and %q", ex.Calls()[0].Args, logs)
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF")) || !bytes.Contains(data, []byte("(Jane)")) || bytes.Contains(data, []byte("CreationDate")) {
+		t.Fatalf("expected a rewritten PDF on stdout, got\n%s", data)
+	}
+
+	ex = wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: []byte("%PDF-1.4\n")})
+	data = captureStdout(t, func() {
+		_, err = pfs.GenerateContext(context.Background(), ex, "https://example.com", "-")
+	})
+	var outputErr *wkhtmltox.OutputError
+	if !errors.As(err, &outputErr) || len(data) != 0 {
+		t.Fatalf("expected an *OutputError and nothing on stdout, got %v and %q", err, data)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	attempts := 0
+	var body []byte
+	var header http.Header
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Method != http.MethodPut || r.URL.Path != "/bucket/report.pdf" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer store.Close()
+
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	pfs := wkhtmltox.PDFFlagSet{}
+	sink := wkhtmltox.HTTPSink{
+		URL:     store.URL + "/bucket/report.pdf",
+		Header:  http.Header{"X-Amz-Meta-Report": {"monthly"}},
+		Backoff: time.Millisecond,
+	}
+
+	if _, err := pfs.GenerateTo(context.Background(), ex, testSource, sink); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if attempts != 3 || string(body) != string(wkhtmltoxtest.PDF(1)) {
+		t.Fatalf("unexpected upload after %d attempts: %q", attempts, body)
+	}
+
+	if header.Get("Content-Type") != "application/pdf" || header.Get("X-Amz-Meta-Report") != "monthly" {
+		t.Fatalf("unexpected headers %v", header)
+	}
+}
+
+func TestHTTPSinkRejected(t *testing.T) {
+	attempts := 0
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer store.Close()
+
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	pfs := wkhtmltox.PDFFlagSet{}
+	sink := wkhtmltox.HTTPSink{URL: store.URL, ContentType: "application/x-report", Backoff: time.Millisecond}
+
+	var uploadErr *wkhtmltox.UploadError
+	_, err := pfs.GenerateTo(context.Background(), ex, testSource, sink)
+	if !errors.As(err, &uploadErr) || uploadErr.StatusCode != http.StatusForbidden || uploadErr.Attempts != 1 || attempts != 1 {
+		t.Fatalf("expected a single rejected attempt, got %v", err)
+	}
+
+	if _, err := os.Stat(outputArg(ex)); !os.IsNotExist(err) {
+		t.Fatalf("expected the staged output to be removed, got %v", err)
+	}
+}
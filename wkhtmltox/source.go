@@ -0,0 +1,242 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+)
+
+// InputSource provides the input of a conversion. Sources set up whatever
+// the converter needs to read them, such as a loopback server or a pipe to
+// standard input, when opened, and tear it down when closed.
+type InputSource interface {
+	Open(ctx context.Context) (Input, error)
+}
+
+// Input is an InputSource opened for a single conversion
+type Input interface {
+	// URL returns the input argument of the converter, "-" to read Stdin
+	URL() string
+
+	// Stdin returns what the converter reads when URL is "-", or nil
+	Stdin() io.Reader
+
+	// Close releases the input once the conversion has finished. It
+	// returns any error that occurred while producing the input, which
+	// takes precedence over the conversion's own error.
+	Close() error
+}
+
+// openedInput is an Input whose release, if any, is done by close
+type openedInput struct {
+	url   string
+	stdin io.Reader
+	close func() error
+}
+
+func (oi *openedInput) URL() string      { return oi.url }
+func (oi *openedInput) Stdin() io.Reader { return oi.stdin }
+
+func (oi *openedInput) Close() error {
+	if oi.close == nil {
+		return nil
+	}
+
+	return oi.close()
+}
+
+// URLSource is a URL or path passed to the converter as it is
+type URLSource struct {
+	URL string
+}
+
+// Open implements InputSource
+func (us URLSource) Open(ctx context.Context) (Input, error) {
+	return &openedInput{url: us.URL}, nil
+}
+
+// FileSource is a local file, which must exist
+type FileSource struct {
+	Path string
+}
+
+// Open implements InputSource
+func (fsrc FileSource) Open(ctx context.Context) (Input, error) {
+	abs, err := normalizePath("input", fsrc.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(abs); err != nil {
+		return nil, err
+	}
+
+	return &openedInput{url: abs}, nil
+}
+
+// BytesSource is an HTML document held in memory, piped to the converter's
+// standard input. Relative links in it do not resolve.
+type BytesSource struct {
+	Data []byte
+}
+
+// Open implements InputSource
+func (bs BytesSource) Open(ctx context.Context) (Input, error) {
+	return &openedInput{url: stdStream, stdin: bytes.NewReader(bs.Data)}, nil
+}
+
+// ReaderSource is an HTML document read from Reader and piped to the
+// converter's standard input. Relative links in it do not resolve.
+type ReaderSource struct {
+	Reader io.Reader
+}
+
+// Open implements InputSource
+func (rs ReaderSource) Open(ctx context.Context) (Input, error) {
+	return &openedInput{url: stdStream, stdin: rs.Reader}, nil
+}
+
+// FSSource is the file Entry in FS, served with the rest of FS from a
+// loopback HTTP server so relative URLs, fonts and XHR work
+type FSSource struct {
+	FS    fs.FS
+	Entry string
+}
+
+// Open implements InputSource
+func (fss FSSource) Open(ctx context.Context) (Input, error) {
+	if _, err := fs.Stat(fss.FS, fss.Entry); err != nil {
+		return nil, err
+	}
+
+	s, err := ServeFS(fss.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openedInput{url: s.URL(fss.Entry), close: s.Close}, nil
+}
+
+// TemplateSource is the HTML produced by executing Template with Data. It is
+// streamed to the converter's standard input, or, when Assets is set, served
+// at Entry beside them from a loopback HTTP server so relative URLs resolve.
+// A failure to execute Template is reported as a *TemplateError.
+type TemplateSource struct {
+	Template *template.Template
+	Data     interface{}
+	Assets   fs.FS  // Files the template links to, or nil
+	Entry    string // Path the page is served at among Assets, DefaultBundleEntry if empty
+}
+
+// Open implements InputSource
+func (ts TemplateSource) Open(ctx context.Context) (Input, error) {
+	run := &templateRun{tmpl: ts.Template, data: ts.Data}
+
+	if ts.Assets == nil {
+		pr, pw := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			run.execute(pw)
+			pw.CloseWithError(run.templateErr())
+		}()
+
+		return &openedInput{url: stdStream, stdin: pr, close: func() error {
+			// Unblock the template if the converter stopped reading early
+			pr.Close()
+			<-done
+
+			return run.templateErr()
+		}}, nil
+	}
+
+	entry := ts.Entry
+	if entry == "" {
+		entry = DefaultBundleEntry
+	}
+	entry = path.Join("/", entry)
+
+	assets := http.FileServerFS(ts.Assets)
+	s, err := serveHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != entry {
+			assets.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		run.execute(w)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &openedInput{url: s.URL(entry), close: func() error {
+		// The template may still be executing for a request in progress, so
+		// wait for it before reading its error
+		err := s.shutdown()
+
+		if tmplErr := run.templateErr(); tmplErr != nil {
+			return tmplErr
+		}
+
+		return err
+	}}, nil
+}
+
+// generateSource opens src, runs the conversion built by command on it and
+// closes it again
+func generateSource(ctx context.Context, ex Executor, src InputSource, command func(inputURL string) (Command, error)) ([]byte, error) {
+	in, err := src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := func() ([]byte, error) {
+		cmd, err := command(in.URL())
+		if err != nil {
+			return nil, err
+		}
+
+		return runConversionInput(ctx, ex, cmd, in.Stdin())
+	}()
+
+	if closeErr := in.Close(); closeErr != nil {
+		return out, closeErr
+	}
+
+	return out, err
+}
+
+// GenerateSource performs the image conversion of src using ex, or
+// DefaultExecutor if ex is nil, and saves the file to disk
+func (ifs *ImageFlagSet) GenerateSource(ctx context.Context, ex Executor, src InputSource, outputFile string) ([]byte, error) {
+	return generateFile(ctx, ex, newOutputCheck(ImageConverter, flagSet(*ifs)), src, outputFile, ifs.Command)
+}
+
+// GenerateSource performs the PDF conversion of src using ex, or
+// DefaultExecutor if ex is nil, and saves the file to disk
+func (pfs *PDFFlagSet) GenerateSource(ctx context.Context, ex Executor, src InputSource, outputFile string) ([]byte, error) {
+	return generateFile(ctx, ex, newOutputCheck(PDFConverter, flagSet(*pfs)), src, outputFile, pfs.Command)
+}
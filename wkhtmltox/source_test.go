@@ -0,0 +1,107 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestGenerateSource(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(page, []byte("<p>file</p>"), 0644)
+
+	tests := []struct {
+		src   wkhtmltox.InputSource
+		input string
+		stdin string
+	}{
+		{wkhtmltox.URLSource{URL: "https://example.com"}, "https://example.com", ""},
+		{wkhtmltox.FileSource{Path: page}, page, ""},
+		{wkhtmltox.BytesSource{Data: []byte("<p>bytes</p>")}, "-", "<p>bytes</p>"},
+		{wkhtmltox.ReaderSource{Reader: strings.NewReader("<p>reader</p>")}, "-", "<p>reader</p>"},
+	}
+
+	for _, test := range tests {
+		ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+		pfs := wkhtmltox.PDFFlagSet{}
+
+		if _, err := pfs.GenerateSource(context.Background(), ex, test.src, filepath.Join(t.TempDir(), "file.pdf")); err != nil {
+			t.Fatalf("expected no error for %T, got %v", test.src, err)
+		}
+
+		call := ex.Calls()[0]
+		if call.Args[0] != test.input || string(call.StdinData) != test.stdin {
+			t.Fatalf("unexpected call for %T: '%s' with %q", test.src, call.Args, call.StdinData)
+		}
+	}
+}
+
+func TestFileSourceMissing(t *testing.T) {
+	ifs := wkhtmltox.ImageFlagSet{}
+
+	_, err := ifs.GenerateSource(context.Background(), wkhtmltoxtest.NewExecutor(), wkhtmltox.FileSource{Path: "missing.html"}, "-")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+// countingSource is a custom InputSource whose Close fails
+type countingSource struct {
+	opened, closed int
+}
+
+type countingInput struct {
+	src *countingSource
+}
+
+func (cs *countingSource) Open(ctx context.Context) (wkhtmltox.Input, error) {
+	cs.opened++
+	return countingInput{cs}, nil
+}
+
+func (ci countingInput) URL() string      { return "https://example.com" }
+func (ci countingInput) Stdin() io.Reader { return nil }
+
+func (ci countingInput) Close() error {
+	ci.src.closed++
+	return errors.New("input broke")
+}
+
+func TestCustomSource(t *testing.T) {
+	src := &countingSource{}
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{ExitCode: 1})
+	pfs := wkhtmltox.PDFFlagSet{}
+
+	_, err := pfs.GenerateSource(context.Background(), ex, src, "-")
+	if err == nil || err.Error() != "input broke" {
+		t.Fatalf("expected the input's error to take precedence, got %v", err)
+	}
+
+	if src.opened != 1 || src.closed != 1 {
+		t.Fatalf("expected the source to be opened and closed once, got %d and %d", src.opened, src.closed)
+	}
+}
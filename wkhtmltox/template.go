@@ -0,0 +1,113 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// TemplateOptions configures RenderTemplate
+type TemplateOptions struct {
+	PDF      *PDFOptions   // Converter options for a PDF, the default output
+	Image    *ImageOptions // Converter options for an image, rendered instead of a PDF if set
+	Assets   fs.FS         // Files the template links to, such as stylesheets and fonts, or nil
+	Entry    string        // Path the page is served at among Assets, DefaultBundleEntry if empty
+	Executor Executor      // How to run converters, nil for DefaultExecutor
+}
+
+// TemplateError is returned when a template fails to execute, as opposed to
+// the conversion failing
+type TemplateError struct {
+	Err error
+}
+
+func (e *TemplateError) Error() string {
+	return "wkhtmltox: executing template: " + e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// templateRun executes a template into a writer, telling template errors
+// apart from failures to write the output
+type templateRun struct {
+	tmpl *template.Template
+	data interface{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (tr *templateRun) execute(w io.Writer) {
+	ew := &errWriter{w: w}
+	err := tr.tmpl.Execute(ew, tr.data)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err != nil && ew.err == nil && tr.err == nil {
+		tr.err = err
+	}
+}
+
+func (tr *templateRun) templateErr() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.err != nil {
+		return &TemplateError{Err: tr.err}
+	}
+
+	return nil
+}
+
+// errWriter remembers the first error from the writer it wraps
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	n, err := ew.w.Write(p)
+	if err != nil && ew.err == nil {
+		ew.err = err
+	}
+
+	return n, err
+}
+
+// RenderTemplate executes tmpl with data and renders the HTML it produces,
+// which is streamed to the converter rather than written to disk. Without
+// Assets the HTML is piped to the converter's standard input. With Assets,
+// the page is served at Entry beside them from a loopback HTTP server, so
+// relative URLs resolve. A failure to execute tmpl is reported as a
+// *TemplateError.
+func RenderTemplate(ctx context.Context, tmpl *template.Template, data interface{}, opts TemplateOptions) (*Result, error) {
+	lr := LocalRenderer{Executor: opts.Executor}
+	src := TemplateSource{Template: tmpl, Data: data, Assets: opts.Assets, Entry: opts.Entry}
+
+	if opts.Image != nil {
+		return lr.ImageSource(ctx, src, opts.Image)
+	}
+
+	return lr.PDFSource(ctx, src, opts.PDF)
+}
@@ -0,0 +1,170 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+type invoice struct {
+	Customer string
+	Total    float64
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(
+	`<link href="css/site.css"><h1>{{.Customer}}</h1><p>{{printf "%.2f" .Total}}</p>`,
+))
+
+func TestRenderTemplateStdin(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+	title := "Invoice"
+
+	result, err := wkhtmltox.RenderTemplate(context.Background(), invoiceTemplate, invoice{"<Acme>", 12.5}, wkhtmltox.TemplateOptions{
+		PDF:      &wkhtmltox.PDFOptions{Title: &title},
+		Executor: ex,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if string(result.Data) != string(wkhtmltoxtest.PDF(1)) || result.ContentType != "application/pdf" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	call := ex.Calls()[0]
+	if call.Args[0] != "--title" || call.Args[2] != "-" {
+		t.Fatalf("expected the input to be standard input, got '%s'", call.Args)
+	}
+
+	if html := string(call.StdinData); html != `<link href="css/site.css"><h1>&lt;Acme&gt;</h1><p>12.50</p>` {
+		t.Fatalf("unexpected HTML %q", html)
+	}
+}
+
+func TestRenderTemplateImage(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PNG(8, 8)})
+
+	result, err := wkhtmltox.RenderTemplate(context.Background(), invoiceTemplate, invoice{"Acme", 1}, wkhtmltox.TemplateOptions{
+		Image:    &wkhtmltox.ImageOptions{},
+		Executor: ex,
+	})
+	if err != nil || result.ContentType != "image/png" {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+
+	if call := ex.Calls()[0]; call.Binary != "wkhtmltoimage" {
+		t.Fatalf("expected wkhtmltoimage, got %s", call.Binary)
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	broken := template.Must(template.New("broken").Parse(`<p>{{.Missing}}</p>`))
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{OutputFile: wkhtmltoxtest.PDF(1)})
+
+	var tmplErr *wkhtmltox.TemplateError
+	_, err := wkhtmltox.RenderTemplate(context.Background(), broken, invoice{}, wkhtmltox.TemplateOptions{Executor: ex})
+	if !errors.As(err, &tmplErr) {
+		t.Fatalf("expected a *TemplateError, got %v", err)
+	}
+
+	failing := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{ExitCode: 1})
+	var exitErr *wkhtmltox.ExitError
+	_, err = wkhtmltox.RenderTemplate(context.Background(), invoiceTemplate, invoice{}, wkhtmltox.TemplateOptions{Executor: failing})
+	if !errors.As(err, &exitErr) || errors.As(err, &tmplErr) {
+		t.Fatalf("expected only an *ExitError, got %v", err)
+	}
+}
+
+// templateExecutor fetches the served page and its stylesheet
+type templateExecutor struct {
+	pages []string
+}
+
+func (te *templateExecutor) Execute(ctx context.Context, e wkhtmltox.Execution) (wkhtmltox.Output, error) {
+	input := e.Args[len(e.Args)-2]
+
+	for _, u := range []string{input, strings.TrimSuffix(input, "index.html") + "css/site.css"} {
+		resp, err := http.Get(u)
+		if err != nil {
+			return wkhtmltox.Output{}, err
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		te.pages = append(te.pages, string(data))
+	}
+
+	return wkhtmltox.Output{}, os.WriteFile(e.Args[len(e.Args)-1], wkhtmltoxtest.PDF(1), 0644)
+}
+
+func TestTemplateSourceCloseWaitsForRequests(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	tmpl := template.Must(template.New("page").Funcs(template.FuncMap{"slow": func() string {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+		return "done"
+	}}).Parse(`<p>{{slow}}</p>`))
+
+	in, err := wkhtmltox.TemplateSource{Template: tmpl, Assets: fstest.MapFS{}}.Open(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	go func() {
+		if resp, err := http.Get(in.URL()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	if err := in.Close(); err != nil || !finished.Load() {
+		t.Fatalf("expected Close to wait for the request, got %v", err)
+	}
+}
+
+func TestRenderTemplateAssets(t *testing.T) {
+	ex := &templateExecutor{}
+	assets := fstest.MapFS{"invoices/css/site.css": {Data: []byte("h1 {}")}}
+
+	result, err := wkhtmltox.RenderTemplate(context.Background(), invoiceTemplate, invoice{"Acme", 3}, wkhtmltox.TemplateOptions{
+		Assets:   assets,
+		Entry:    "invoices/index.html",
+		Executor: ex,
+	})
+	if err != nil || string(result.Data) != string(wkhtmltoxtest.PDF(1)) {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+
+	if len(ex.pages) != 2 || !strings.Contains(ex.pages[0], "<h1>Acme</h1>") || ex.pages[1] != "h1 {}" {
+		t.Fatalf("unexpected pages %q", ex.pages)
+	}
+}
@@ -18,11 +18,40 @@
 package wkhtmltox
 
 import (
-	"strings"
-
+	"fmt"
+	"os"
 	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// Matches option lines of --extended-help, such as
+// "  -g, --grayscale    Generate PDF in grayscale" and
+// "      --disable-smart-shrinking *   Disable the intelligent shrinking".
+var helpFlagPattern = regexp.MustCompile(`(?m)^\s+(?:-[A-Za-z], )?--([a-z0-9][a-z0-9-]*)((?:\s+<[^>]*>)*)(\s+\*)?`)
+
+// ConverterInfo describes an installed converter
+type ConverterInfo struct {
+	Path      string // Absolute path of the executable
+	Version   string // Raw output of --version
+	Major     int
+	Minor     int
+	Patch     int
+	PatchedQt bool // Built against the wkhtmltopdf fork of Qt
+
+	flags map[string]bool // Flag names listed by --extended-help, and whether they need patched Qt
+}
+
+var converterInfoCache = struct {
+	sync.Mutex
+	entries map[string]ConverterInfo
+}{entries: make(map[string]ConverterInfo)}
+
 // LookupConverter checks if converter executable exists and returns
 // it's path and version.
 func LookupConverter(name string) (string, string, error) {
@@ -39,3 +68,117 @@ func LookupConverter(name string) (string, string, error) {
 
 	return path, version, err
 }
+
+// ParseConverterVersion parses the output of --version, such as
+// "wkhtmltopdf 0.12.6 (with patched qt)"
+func ParseConverterVersion(version string) (ConverterInfo, error) {
+	version = strings.TrimSpace(version)
+	info := ConverterInfo{Version: version}
+
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return info, fmt.Errorf("wkhtmltox: cannot parse converter version %q", version)
+	}
+
+	info.Major, _ = strconv.Atoi(m[1])
+	info.Minor, _ = strconv.Atoi(m[2])
+	info.Patch, _ = strconv.Atoi(m[3])
+	info.PatchedQt = strings.Contains(strings.ToLower(version), "with patched qt")
+
+	return info, nil
+}
+
+// LookupConverterInfo finds a converter executable and describes its version
+// and the flags it supports. A converter is only run once, with --version and
+// --extended-help, for as long as its executable is unchanged.
+func LookupConverterInfo(name string) (ConverterInfo, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ConverterInfo{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return ConverterInfo{}, err
+	}
+	key := fmt.Sprintf("%s|%d|%d", path, stat.Size(), stat.ModTime().UnixNano())
+
+	converterInfoCache.Lock()
+	info, cached := converterInfoCache.entries[key]
+	converterInfoCache.Unlock()
+	if cached {
+		return info, nil
+	}
+
+	out, err := exec.Command(path, "--version").CombinedOutput()
+	if err != nil {
+		return ConverterInfo{}, err
+	}
+
+	info, err = ParseConverterVersion(string(out))
+	if err != nil {
+		return ConverterInfo{}, err
+	}
+	info.Path = path
+
+	// Some builds exit non-zero after printing help, so only the output matters
+	help, _ := exec.Command(path, "--extended-help").CombinedOutput()
+	info.flags = parseHelpFlags(string(help))
+
+	converterInfoCache.Lock()
+	converterInfoCache.entries[key] = info
+	converterInfoCache.Unlock()
+
+	return info, nil
+}
+
+func parseHelpFlags(help string) map[string]bool {
+	flags := make(map[string]bool)
+
+	for _, m := range helpFlagPattern.FindAllStringSubmatch(help, -1) {
+		flags[m[1]] = m[3] != ""
+	}
+
+	return flags
+}
+
+// Compare returns -1, 0 or +1 depending on whether the converter version is
+// older than, the same as or newer than major.minor.patch
+func (ci ConverterInfo) Compare(major int, minor int, patch int) int {
+	for _, d := range []int{ci.Major - major, ci.Minor - minor, ci.Patch - patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// AtLeast reports whether the converter version is major.minor.patch or newer
+func (ci ConverterInfo) AtLeast(major int, minor int, patch int) bool {
+	return ci.Compare(major, minor, patch) >= 0
+}
+
+// Supports reports whether the converter accepts a flag, given without its
+// leading dashes. Flags that need patched Qt are unsupported on other builds.
+func (ci ConverterInfo) Supports(flag string) bool {
+	needsPatchedQt, listed := ci.flags[flag]
+
+	return listed && (ci.PatchedQt || !needsPatchedQt)
+}
+
+// Flags returns the sorted names of the flags the converter supports
+func (ci ConverterInfo) Flags() []string {
+	var flags []string
+	for flag := range ci.flags {
+		if ci.Supports(flag) {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Strings(flags)
+
+	return flags
+}
@@ -16,3 +16,81 @@
 // along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
 
 package wkhtmltox_test
+
+import (
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestParseConverterVersion(t *testing.T) {
+	info, err := wkhtmltox.ParseConverterVersion("wkhtmltopdf 0.12.6 (with patched qt)\n")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if info.Major != 0 || info.Minor != 12 || info.Patch != 6 || !info.PatchedQt {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	info, _ = wkhtmltox.ParseConverterVersion("wkhtmltoimage 0.12.4")
+	if info.Patch != 4 || info.PatchedQt {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	if _, err := wkhtmltox.ParseConverterVersion("command not found"); err == nil {
+		t.Fatal("expected an error for unparseable output")
+	}
+}
+
+func TestConverterInfoCompare(t *testing.T) {
+	info := wkhtmltox.ConverterInfo{Major: 0, Minor: 12, Patch: 5}
+
+	if info.Compare(0, 12, 5) != 0 || info.Compare(0, 12, 6) != -1 || info.Compare(0, 11, 9) != 1 {
+		t.Fatalf("unexpected comparisons for %+v", info)
+	}
+
+	if !info.AtLeast(0, 12, 0) || info.AtLeast(0, 13, 0) {
+		t.Fatalf("unexpected AtLeast for %+v", info)
+	}
+}
+
+func TestLookupConverterInfo(t *testing.T) {
+	f := wkhtmltoxtest.InstallFakeConverters(t)
+
+	info, err := wkhtmltox.LookupConverterInfo("wkhtmltopdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !info.PatchedQt || !info.AtLeast(0, 12, 6) || !info.Supports("title") || !info.Supports("disable-smart-shrinking") || info.Supports("no-such-flag") {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	// the result is cached, so the converter only ran for --version and --extended-help
+	wkhtmltox.LookupConverterInfo("wkhtmltopdf")
+	if invocations, _ := f.Invocations(); len(invocations) != 2 {
+		t.Fatalf("expected 2 invocations, got %q", invocations)
+	}
+}
+
+func TestLookupConverterInfoUnpatchedQt(t *testing.T) {
+	f := wkhtmltoxtest.InstallFakeConverters(t)
+	f.SetVersion(t, "0.12.5")
+
+	info, err := wkhtmltox.LookupConverterInfo("wkhtmltopdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if info.PatchedQt || info.Supports("disable-smart-shrinking") || !info.Supports("grayscale") {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	for _, flag := range info.Flags() {
+		if flag == "toc" {
+			t.Fatalf("expected %s not to be supported without patched Qt", flag)
+		}
+	}
+}
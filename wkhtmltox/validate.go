@@ -0,0 +1,262 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Standard streams, as understood by the converters
+const stdStream = "-"
+
+// Schemes an input URL may use
+var allowedInputSchemes = []string{
+	"file",
+	"http",
+	"https",
+}
+
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+var schemePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+
+// Schemes WebKit loads without a "//" after them, which are checked even
+// though "host:port" inputs look the same
+var opaqueSchemes = []string{
+	"about",
+	"blob",
+	"data",
+	"file",
+	"http",
+	"https",
+	"javascript",
+	"mailto",
+	"qrc",
+}
+
+// UnsafeArgumentError is returned when a flag or positional argument could be
+// misread by the converter, for example as an extra flag
+type UnsafeArgumentError struct {
+	Name   string // Flag key, or "input" or "output" for positional arguments
+	Value  string // Offending value
+	Reason string // Why the value was rejected
+}
+
+func (e *UnsafeArgumentError) Error() string {
+	return fmt.Sprintf("wkhtmltox: unsafe %s %q: %s", e.Name, e.Value, e.Reason)
+}
+
+func checkFlagValue(key string, value string) error {
+	if strings.HasPrefix(value, "-") {
+		return &UnsafeArgumentError{Name: key, Value: value, Reason: "value starts with a dash"}
+	}
+
+	if strings.ContainsRune(value, 0) {
+		return &UnsafeArgumentError{Name: key, Value: value, Reason: "value contains a NUL byte"}
+	}
+
+	return nil
+}
+
+func validateFlagSet(fs flagSet) error {
+	for _, key := range sortedFlagKeys(fs) {
+		if !flagKeyPattern.MatchString(key) {
+			return &UnsafeArgumentError{Name: "flag", Value: key, Reason: "not a valid flag name"}
+		}
+
+		var values []string
+		switch v := fs[key].(type) {
+		case string:
+			values = []string{v}
+		case []string:
+			values = v
+		case []CookieSet:
+			for _, cs := range v {
+				values = append(values, cs.Name, cs.Value)
+			}
+		case []HeaderSet:
+			for _, hs := range v {
+				values = append(values, hs.Name, hs.Value)
+			}
+		}
+
+		for _, value := range values {
+			if err := checkFlagValue(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeInput checks that inputURL is either "-" (standard input), a URL
+// with an allowed scheme or a local path. Paths that are written as paths or
+// exist are made absolute, and anything else, such as "example.com/page" or
+// "localhost:8080/page", is left for the converter to read as a URL. Anything
+// starting with a dash is rejected.
+func normalizeInput(inputURL string) (string, error) {
+	if inputURL == stdStream {
+		return inputURL, nil
+	}
+
+	if err := checkPositional("input", inputURL); err != nil {
+		return "", err
+	}
+
+	if isLocalPath(inputURL) {
+		return normalizePath("input", inputURL)
+	}
+
+	if hasScheme(inputURL) {
+		u, err := url.Parse(inputURL)
+		if err != nil {
+			return "", &UnsafeArgumentError{Name: "input", Value: inputURL, Reason: err.Error()}
+		}
+
+		if !checkStringSliceContains(allowedInputSchemes, strings.ToLower(u.Scheme)) {
+			return "", &UnsafeArgumentError{Name: "input", Value: inputURL, Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+		}
+
+		return inputURL, nil
+	}
+
+	if _, err := os.Stat(inputURL); err == nil {
+		return normalizePath("input", inputURL)
+	}
+
+	return inputURL, nil
+}
+
+// ResolveInput classifies inputURL the way Generate and Command do, for code
+// that must treat inputs alike without running a converter. It returns the
+// absolute path of a local file, given as a path or a file URL, and true.
+// Otherwise it returns the URL the converters load, with inputs without a
+// scheme, such as "example.com/page", given the http scheme as the converters
+// do. Inputs Command rejects are reported as an *UnsafeArgumentError.
+func ResolveInput(inputURL string) (string, bool, error) {
+	normalized, err := normalizeInput(inputURL)
+	if err != nil || normalized == stdStream {
+		return normalized, false, err
+	}
+
+	if !hasScheme(normalized) {
+		if filepath.IsAbs(normalized) {
+			return normalized, true, nil
+		}
+
+		return "http://" + normalized, false, nil
+	}
+
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", false, &UnsafeArgumentError{Name: "input", Value: inputURL, Reason: err.Error()}
+	}
+	if strings.EqualFold(u.Scheme, "file") {
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+
+		return filepath.FromSlash(path), true, nil
+	}
+
+	return normalized, false, nil
+}
+
+// hasScheme reports whether inputURL starts with a URL scheme, which is when
+// the scheme is followed by "//" or is one of opaqueSchemes. Other prefixes,
+// such as the host in "localhost:8080/page", are not treated as schemes.
+func hasScheme(inputURL string) bool {
+	m := schemePattern.FindStringSubmatch(inputURL)
+	if m == nil {
+		return false
+	}
+
+	return strings.HasPrefix(inputURL[len(m[0]):], "//") || checkStringSliceContains(opaqueSchemes, strings.ToLower(m[1]))
+}
+
+// isLocalPath reports whether path is absolute or explicitly relative to the
+// working directory
+func isLocalPath(path string) bool {
+	if filepath.IsAbs(path) {
+		return true
+	}
+
+	for _, prefix := range []string{"/", "./", "../", "." + string(filepath.Separator), ".." + string(filepath.Separator)} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeOutput checks that outputFile is either "-" (standard output) or a
+// local path, which is made absolute. Anything else starting with a dash is
+// rejected.
+func normalizeOutput(outputFile string) (string, error) {
+	if outputFile == stdStream {
+		return outputFile, nil
+	}
+
+	if err := checkPositional("output", outputFile); err != nil {
+		return "", err
+	}
+
+	return normalizePath("output", outputFile)
+}
+
+func checkPositional(name string, value string) error {
+	if value == "" {
+		return &UnsafeArgumentError{Name: name, Value: value, Reason: "value is empty"}
+	}
+
+	if strings.HasPrefix(value, "-") {
+		return &UnsafeArgumentError{Name: name, Value: value, Reason: "value starts with a dash"}
+	}
+
+	if strings.ContainsRune(value, 0) {
+		return &UnsafeArgumentError{Name: name, Value: value, Reason: "value contains a NUL byte"}
+	}
+
+	return nil
+}
+
+func normalizePath(name string, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", &UnsafeArgumentError{Name: name, Value: path, Reason: err.Error()}
+	}
+
+	return abs, nil
+}
+
+// Validate checks that no value in an ImageFlagSet could be read as a flag
+func (ifs *ImageFlagSet) Validate() error {
+	return validateFlagSet(flagSet(*ifs))
+}
+
+// Validate checks that no value in a PDFFlagSet could be read as a flag
+func (pfs *PDFFlagSet) Validate() error {
+	return validateFlagSet(flagSet(*pfs))
+}
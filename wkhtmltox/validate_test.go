@@ -0,0 +1,231 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltox_test
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+func TestCommandRejectsDashedInput(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+
+	for _, input := range []string{"--run-script evil.js", "", "javascript:alert(1)", "JavaScript:alert(1)", "data:text/html,<p>hi</p>", "ftp://example.com/page"} {
+		_, err := pfs.Command(input, "/tmp/file.pdf")
+
+		var unsafeErr *wkhtmltox.UnsafeArgumentError
+		if !errors.As(err, &unsafeErr) || unsafeErr.Name != "input" {
+			t.Fatalf("expected input %q to be rejected, got %v", input, err)
+		}
+	}
+}
+
+func TestCommandNormalizesLocalPaths(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+
+	if _, err := ifs.Command("http://example.com", "-out.png"); err == nil {
+		t.Fatal("expected a dashed output to be rejected")
+	}
+
+	cmd, err := ifs.Command("./pages/index.html", "out.png")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	input, _ := filepath.Abs("pages/index.html")
+	output, _ := filepath.Abs("out.png")
+	if cmd.Args[0] != input || cmd.Args[1] != output {
+		t.Fatalf("expected paths '%s' and '%s', got '%s'", input, output, cmd.Args)
+	}
+
+	// Existing files are local even without a leading "./"
+	cmd, _ = ifs.Command("validate_test.go", "out.png")
+	if input, _ := filepath.Abs("validate_test.go"); cmd.Args[0] != input {
+		t.Fatalf("expected path '%s', got '%s'", input, cmd.Args[0])
+	}
+}
+
+func TestCommandKeepsSchemelessURLs(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+
+	for _, input := range []string{"duckduckgo.com", "example.com/page", "pages/missing.html", "localhost:8080/x", "example.com:443"} {
+		cmd, err := pfs.Command(input, "/tmp/file.pdf")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if cmd.Args[0] != input {
+			t.Fatalf("expected input '%s' to be kept, got '%s'", input, cmd.Args[0])
+		}
+	}
+
+	// Outside Windows, where it is a drive, "c:" is a scheme like any other
+	if _, err := pfs.Command("c://page", "/tmp/file.pdf"); err == nil && runtime.GOOS != "windows" {
+		t.Fatal("expected a single letter scheme to be checked")
+	}
+}
+
+func TestResolveInput(t *testing.T) {
+	page, _ := filepath.Abs("validate_test.go")
+	missing, _ := filepath.Abs("pages/missing.html")
+
+	for input, expected := range map[string]struct {
+		value string
+		local bool
+	}{
+		"https://example.com/page": {"https://example.com/page", false},
+		"example.com/page":         {"http://example.com/page", false},
+		"localhost:8080/x":         {"http://localhost:8080/x", false},
+		"pages/missing.html":       {"http://pages/missing.html", false},
+		"validate_test.go":         {page, true},
+		"./pages/missing.html":     {missing, true},
+		"file:///tmp/page.html":    {filepath.FromSlash("/tmp/page.html"), true},
+		"FILE:///tmp/page.html":    {filepath.FromSlash("/tmp/page.html"), true},
+	} {
+		value, local, err := wkhtmltox.ResolveInput(input)
+		if err != nil || value != expected.value || local != expected.local {
+			t.Fatalf("expected %q to resolve to %q (local %t), got %q (local %t), %v", input, expected.value, expected.local, value, local, err)
+		}
+	}
+
+	var unsafeErr *wkhtmltox.UnsafeArgumentError
+	if _, _, err := wkhtmltox.ResolveInput("javascript:alert(1)"); !errors.As(err, &unsafeErr) {
+		t.Fatalf("expected an *UnsafeArgumentError, got %v", err)
+	}
+}
+
+func TestCommandAllowsStandardStreams(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+
+	cmd, err := pfs.Command("-", "-")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cmd.Args[0] != "-" || cmd.Args[1] != "-" {
+		t.Fatalf("expected standard streams to be kept, got '%s'", cmd.Args)
+	}
+}
+
+func TestPDFFlagSetValidate(t *testing.T) {
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetTitle("-- not a flag")
+
+	var unsafeErr *wkhtmltox.UnsafeArgumentError
+	if err := pfs.Validate(); !errors.As(err, &unsafeErr) || unsafeErr.Name != "title" {
+		t.Fatalf("expected title to be rejected, got %v", err)
+	}
+
+	pfs = make(wkhtmltox.PDFFlagSet)
+	pfs.SetCustomHeader([]wkhtmltox.HeaderSet{{Name: "X-Test", Value: "--run-script"}})
+	if err := pfs.Validate(); !errors.As(err, &unsafeErr) || unsafeErr.Name != "custom-header" {
+		t.Fatalf("expected custom-header to be rejected, got %v", err)
+	}
+
+	pfs = make(wkhtmltox.PDFFlagSet)
+	pfs["run-script evil.js"] = true
+	if err := pfs.Validate(); err == nil {
+		t.Fatal("expected an invalid flag name to be rejected")
+	}
+}
+
+func TestImageFlagSetGenerateRejectsUnsafeValues(t *testing.T) {
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs.SetCookie([]wkhtmltox.CookieSet{{Name: "--allow", Value: "/"}})
+
+	if _, err := ifs.Generate("http://example.com", "/tmp/file.png"); err == nil {
+		t.Fatal("expected an unsafe cookie to be rejected before running the converter")
+	}
+}
+
+// checkNoInjectedFlags walks args using the arity of each flag in the set and
+// fails if a value, or a positional argument, could be read as a flag
+func checkNoInjectedFlags(t *testing.T, args []string, arity map[string]int) {
+	i := 0
+	for i < len(args)-2 {
+		key := strings.TrimPrefix(args[i], "--")
+		n, known := arity[key]
+		if !strings.HasPrefix(args[i], "--") || !known {
+			t.Fatalf("unexpected flag '%s' in '%q'", args[i], args)
+		}
+
+		for j := 1; j <= n; j++ {
+			if strings.HasPrefix(args[i+j], "-") {
+				t.Fatalf("value '%s' of '%s' could be read as a flag in '%q'", args[i+j], args[i], args)
+			}
+		}
+		i += n + 1
+	}
+
+	if i != len(args)-2 {
+		t.Fatalf("expected exactly two positional arguments in '%q'", args)
+	}
+
+	for _, arg := range args[i:] {
+		if arg != "-" && strings.HasPrefix(arg, "-") {
+			t.Fatalf("positional argument '%s' could be read as a flag in '%q'", arg, args)
+		}
+	}
+}
+
+func FuzzPDFFlagSetFlags(f *testing.F) {
+	f.Add("Title", "X-Test", "value", "name", "value")
+	f.Add("--title", "--run-script", "evil.js", "-", "--")
+	f.Add("", "Authorization", "Bearer x", "a b", "'\"")
+
+	f.Fuzz(func(t *testing.T, title string, headerName string, headerValue string, cookieName string, cookieValue string) {
+		pfs := make(wkhtmltox.PDFFlagSet)
+		pfs.SetTitle(title)
+		pfs.SetGrayscale(true)
+		pfs.SetCustomHeader([]wkhtmltox.HeaderSet{{Name: headerName, Value: headerValue}})
+		pfs.SetCookie([]wkhtmltox.CookieSet{{Name: cookieName, Value: cookieValue}})
+
+		if err := pfs.Validate(); err != nil {
+			return
+		}
+
+		arity := map[string]int{"title": 1, "grayscale": 0, "custom-header": 2, "cookie": 2}
+		checkNoInjectedFlags(t, append(pfs.Flags(), "in", "out"), arity)
+	})
+}
+
+func FuzzImageFlagSetCommand(f *testing.F) {
+	f.Add("utf-8", "http://example.com", "/tmp/file.png")
+	f.Add("--run-script", "--run-script evil.js", "-o")
+	f.Add("-", "-", "-")
+	f.Add("a", "file:///etc/passwd", "page.png")
+
+	f.Fuzz(func(t *testing.T, encoding string, inputURL string, outputFile string) {
+		ifs := make(wkhtmltox.ImageFlagSet)
+		ifs.SetEncoding(encoding)
+		ifs.SetTransparent(true)
+
+		cmd, err := ifs.Command(inputURL, outputFile)
+		if err != nil {
+			return
+		}
+
+		arity := map[string]int{"encoding": 1, "transparent": 0}
+		checkNoInjectedFlags(t, cmd.Args, arity)
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltoxtest
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Inputs that make the fake converters fail the way the real ones do
+const (
+	NetworkErrorURL = "http://network-error.wkhtmltoxtest.invalid/" // Exits with status 1 after a load error
+	HangURL         = "http://hang.wkhtmltoxtest.invalid/"          // Never exits
+	CrashURL        = "http://crash.wkhtmltoxtest.invalid/"         // Writes a truncated file and dies from SIGSEGV
+	WarningURL      = "http://warning.wkhtmltoxtest.invalid/"       // Succeeds after warning that an image failed to load
+)
+
+//go:embed fakeconverter/main.go
+var fakeConverterSource []byte
+
+// FakeConverters are stand-in wkhtmltopdf and wkhtmltoimage executables.
+// They accept the same flags as the real converters and write a minimal
+// single-page PDF, dated and with a new document ID each time as real PDFs
+// are, or a white PNG or JPEG sized by --width and --height. With
+// --disable-local-file-access, a local input that links to a file:// URL
+// outside the --allow directories fails with a load error.
+type FakeConverters struct {
+	Dir     string // Directory containing the executables
+	logPath string
+}
+
+// InstallFakeConverters builds the fake converters with the go tool and puts
+// them first on PATH for the rest of the test. The test is skipped if the go
+// tool cannot be found.
+func InstallFakeConverters(t testing.TB) *FakeConverters {
+	t.Helper()
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		goTool = filepath.Join(runtime.GOROOT(), "bin", "go")
+		if _, err := os.Stat(goTool); err != nil {
+			t.Skip("wkhtmltoxtest: go tool not found, cannot build fake converters")
+		}
+	}
+
+	src := t.TempDir()
+	files := map[string][]byte{
+		"go.mod":  []byte("module fakeconverter\n\ngo 1.21\n"),
+		"main.go": fakeConverterSource,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(src, name), data, 0644); err != nil {
+			t.Fatalf("wkhtmltoxtest: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "wkhtmltopdf"+exeSuffix())
+	cmd := exec.Command(goTool, "build", "-o", binary, ".")
+	cmd.Dir = src
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("wkhtmltoxtest: building fake converters: %v\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(binary)
+	if err != nil {
+		t.Fatalf("wkhtmltoxtest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wkhtmltoimage"+exeSuffix()), data, 0755); err != nil {
+		t.Fatalf("wkhtmltoxtest: %v", err)
+	}
+
+	f := &FakeConverters{Dir: dir, logPath: filepath.Join(dir, "invocations.jsonl")}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WKHTMLTOXTEST_LOG", f.logPath)
+
+	return f
+}
+
+// SetVersion changes what the fake converters print for --version, after
+// their name, for the rest of the test
+func (f *FakeConverters) SetVersion(t testing.TB, version string) {
+	t.Setenv("WKHTMLTOXTEST_VERSION", version)
+}
+
+// Invocations returns the command line of every run of the fake converters so
+// far, each starting with the name it was run as
+func (f *FakeConverters) Invocations() ([][]string, error) {
+	file, err := os.Open(f.logPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var invocations [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var args []string
+		if err := json.Unmarshal(scanner.Bytes(), &args); err != nil {
+			return nil, err
+		}
+		invocations = append(invocations, args)
+	}
+
+	return invocations, scanner.Err()
+}
+
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+
+	return ""
+}
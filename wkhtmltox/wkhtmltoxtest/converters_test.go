@@ -0,0 +1,151 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltoxtest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestFakeConvertersLookupConverter(t *testing.T) {
+	f := wkhtmltoxtest.InstallFakeConverters(t)
+
+	path, version, err := wkhtmltox.LookupConverter("wkhtmltopdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if path != filepath.Join(f.Dir, "wkhtmltopdf") || version != "wkhtmltopdf 0.12.6 (with patched qt)" {
+		t.Fatalf("unexpected converter %s (%s)", path, version)
+	}
+
+	f.SetVersion(t, "0.12.5")
+	if _, version, _ = wkhtmltox.LookupConverter("wkhtmltoimage"); version != "wkhtmltoimage 0.12.5" {
+		t.Fatalf("expected version '%s', got '%s'", "wkhtmltoimage 0.12.5", version)
+	}
+}
+
+func TestFakeConvertersGeneratePDF(t *testing.T) {
+	f := wkhtmltoxtest.InstallFakeConverters(t)
+	output := filepath.Join(t.TempDir(), "file.pdf")
+
+	pfs := make(wkhtmltox.PDFFlagSet)
+	pfs.SetTitle("Report")
+	if out, err := pfs.Generate("http://example.com", output); err != nil {
+		t.Fatalf("expected no error, got %v\n%s", err, out)
+	}
+
+	data, _ := os.ReadFile(output)
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.Contains(data, []byte("/Title (Report)")) {
+		t.Fatalf("expected a PDF titled 'Report', got %q", data)
+	}
+
+	invocations, err := f.Invocations()
+	if err != nil || len(invocations) != 1 || invocations[0][0] != "wkhtmltopdf" || invocations[0][1] != "--title" {
+		t.Fatalf("unexpected invocations %q (%v)", invocations, err)
+	}
+}
+
+func TestFakeConvertersGenerateImage(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	output := filepath.Join(t.TempDir(), "file.png")
+
+	ifs := make(wkhtmltox.ImageFlagSet)
+	ifs.SetWidth(64)
+	ifs.SetHeight(32)
+	if out, err := ifs.Generate("http://example.com", output); err != nil {
+		t.Fatalf("expected no error, got %v\n%s", err, out)
+	}
+
+	file, _ := os.Open(output)
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil || img.Bounds().Dx() != 64 || img.Bounds().Dy() != 32 {
+		t.Fatalf("expected a 64x32 PNG, got %v (%v)", img, err)
+	}
+}
+
+func TestFakeConvertersFailures(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	output := filepath.Join(t.TempDir(), "file.pdf")
+	pfs := make(wkhtmltox.PDFFlagSet)
+
+	out, err := pfs.Generate(wkhtmltoxtest.NetworkErrorURL, output)
+	var exitErr *wkhtmltox.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 || !bytes.Contains(out, []byte("HostNotFoundError")) {
+		t.Fatalf("expected a network error, got %v\n%s", err, out)
+	}
+
+	if _, err := pfs.Generate(wkhtmltoxtest.CrashURL, output); err == nil {
+		t.Fatal("expected a crash to be reported")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := pfs.GenerateContext(ctx, nil, wkhtmltoxtest.HangURL, output); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestFakeConvertersOnlyFailForTheirURLs(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := filepath.Join(t.TempDir(), "network-error-hang-crash-warning")
+	os.Mkdir(dir, 0755)
+	pfs := make(wkhtmltox.PDFFlagSet)
+
+	for _, input := range []string{"http://example.com/warning/crash", wkhtmltoxtest.HangURL + "page"} {
+		out, err := pfs.Generate(input, filepath.Join(dir, "file.pdf"))
+		if err != nil || bytes.Contains(out, []byte("Warning")) {
+			t.Fatalf("expected %s to convert normally, got %v\n%s", input, err, out)
+		}
+	}
+}
+
+func TestFakeConvertersBlockLocalFiles(t *testing.T) {
+	wkhtmltoxtest.InstallFakeConverters(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "index.html")
+	os.WriteFile(input, []byte(`<img src="file:///etc/passwd"><img src="file://`+filepath.Join(dir, "logo.png")+`">`), 0600)
+	output := filepath.Join(dir, "file.pdf")
+
+	pfs := make(wkhtmltox.PDFFlagSet)
+	if out, err := pfs.Generate(input, output); err != nil {
+		t.Fatalf("expected local file access to be allowed by default, got %v\n%s", err, out)
+	}
+
+	pfs.SetLocalFileAccess(false)
+	pfs.SetAllow([]string{dir})
+	out, err := pfs.Generate(input, output)
+	if err == nil || !bytes.Contains(out, []byte("Blocked access to file /etc/passwd")) {
+		t.Fatalf("expected /etc/passwd to be blocked, got %v\n%s", err, out)
+	}
+
+	os.WriteFile(input, []byte(`<img src="file://`+filepath.Join(dir, "logo.png")+`">`), 0600)
+	if out, err := pfs.Generate(input, output); err != nil {
+		t.Fatalf("expected files in %s to be allowed, got %v\n%s", dir, err, out)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Package wkhtmltoxtest provides utilities for testing code that uses the
+// wkhtmltox package without the real converters installed.
+package wkhtmltoxtest
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+)
+
+// Response scripts what the fake Executor does for a single execution
+type Response struct {
+	Stdout     []byte            // Written to standard output
+	Stderr     []byte            // Written to standard error, streamed before any Delay
+	ExitCode   int               // Non-zero codes are returned as a *wkhtmltox.ExitError
+	Delay      time.Duration     // How long to run for, cut short if the context is done
+	OutputFile []byte            // Written to the output argument, or standard output if it is "-"
+	Files      map[string][]byte // Other files to write, keyed by path
+	Err        error             // Returned instead of running, if set
+}
+
+// Call records a single execution seen by the fake Executor
+type Call struct {
+	wkhtmltox.Execution
+	StdinData []byte // Everything read from Execution.Stdin
+}
+
+// Executor is a wkhtmltox.Executor that records executions and replays
+// scripted responses instead of running anything. Responses are used in order
+// and the last one is repeated; with none, every execution succeeds silently.
+type Executor struct {
+	mu        sync.Mutex
+	responses []Response
+	calls     []Call
+}
+
+// NewExecutor returns a fake Executor that replays responses
+func NewExecutor(responses ...Response) *Executor {
+	return &Executor{responses: responses}
+}
+
+// Calls returns the executions seen so far
+func (e *Executor) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Call(nil), e.calls...)
+}
+
+// Execute records the execution and plays the next scripted response
+func (e *Executor) Execute(ctx context.Context, exe wkhtmltox.Execution) (wkhtmltox.Output, error) {
+	call := Call{Execution: exe}
+	call.Args = append([]string(nil), exe.Args...)
+	call.Env = append([]string(nil), exe.Env...)
+	if exe.Stdin != nil {
+		call.StdinData, _ = io.ReadAll(exe.Stdin)
+	}
+
+	e.mu.Lock()
+	e.calls = append(e.calls, call)
+	var resp Response
+	if n := len(e.responses); n > 0 {
+		resp = e.responses[0]
+		if n > 1 {
+			e.responses = e.responses[1:]
+		}
+	}
+	e.mu.Unlock()
+
+	if resp.Err != nil {
+		return wkhtmltox.Output{}, resp.Err
+	}
+
+	if exe.Stderr != nil {
+		exe.Stderr.Write(resp.Stderr)
+	}
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return wkhtmltox.Output{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	out := wkhtmltox.Output{
+		Stdout: append([]byte(nil), resp.Stdout...),
+		Stderr: append([]byte(nil), resp.Stderr...),
+	}
+
+	if resp.OutputFile != nil && len(exe.Args) > 0 {
+		output := exe.Args[len(exe.Args)-1]
+		if output == "-" {
+			out.Stdout = append(out.Stdout, resp.OutputFile...)
+		} else if err := os.WriteFile(output, resp.OutputFile, 0644); err != nil {
+			return out, err
+		}
+	}
+
+	for path, data := range resp.Files {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return out, err
+		}
+	}
+
+	out.Combined = append(append([]byte(nil), out.Stdout...), out.Stderr...)
+
+	if resp.ExitCode != 0 {
+		return out, &wkhtmltox.ExitError{Binary: exe.Binary, Code: resp.ExitCode}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,88 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+package wkhtmltoxtest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itskingori/go-wkhtml/wkhtmltox"
+	"github.com/itskingori/go-wkhtml/wkhtmltox/wkhtmltoxtest"
+)
+
+func TestExecutorRecordsCalls(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor()
+	exe := wkhtmltox.Execution{
+		Binary: "wkhtmltopdf",
+		Args:   []string{"-", "-"},
+		Stdin:  strings.NewReader("<p>hello</p>"),
+		Env:    []string{"QT_QPA_PLATFORM=offscreen"},
+	}
+
+	if _, err := ex.Execute(context.Background(), exe); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	calls := ex.Calls()
+	if len(calls) != 1 || calls[0].Binary != "wkhtmltopdf" || string(calls[0].StdinData) != "<p>hello</p>" || calls[0].Env[0] != "QT_QPA_PLATFORM=offscreen" {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
+
+func TestExecutorScriptsResponses(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(
+		wkhtmltoxtest.Response{Stderr: []byte("Loading pages"), ExitCode: 1},
+		wkhtmltoxtest.Response{OutputFile: []byte("%PDF-1.4")},
+	)
+	output := filepath.Join(t.TempDir(), "file.pdf")
+	exe := wkhtmltox.Execution{Binary: "wkhtmltopdf", Args: []string{"http://example.com", output}}
+
+	out, err := ex.Execute(context.Background(), exe)
+	var exitErr *wkhtmltox.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 || string(out.Stderr) != "Loading pages" {
+		t.Fatalf("expected exit status 1, got %v (output %q)", err, out.Stderr)
+	}
+
+	// the last response is repeated
+	for i := 0; i < 2; i++ {
+		if _, err := ex.Execute(context.Background(), exe); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil || string(data) != "%PDF-1.4" {
+		t.Fatalf("expected output file to be written, got %q (%v)", data, err)
+	}
+}
+
+func TestExecutorDelayHonoursContext(t *testing.T) {
+	ex := wkhtmltoxtest.NewExecutor(wkhtmltoxtest.Response{Delay: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := ex.Execute(ctx, wkhtmltox.Execution{Binary: "wkhtmltoimage"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright © 2017 Job King'ori Maina <j@kingori.co>
+//
+// This file is part of go-wkhtml.
+//
+// go-wkhtml is free software: you can redistribute it and/or modify it under
+// the terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// go-wkhtml is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with go-wkhtml. If not, see <http://www.gnu.org/licenses/>.
+
+// Command fakeconverter stands in for wkhtmltopdf and wkhtmltoimage in tests.
+// It is built by wkhtmltoxtest.InstallFakeConverters under both names and
+// decides how to behave from the name it is run as and its command line.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Inputs that select a failure. They must match the URL constants of
+// wkhtmltoxtest, which this program is built without.
+const (
+	networkErrorURL = "http://network-error.wkhtmltoxtest.invalid/"
+	hangURL         = "http://hang.wkhtmltoxtest.invalid/"
+	crashURL        = "http://crash.wkhtmltoxtest.invalid/"
+	warningURL      = "http://warning.wkhtmltoxtest.invalid/"
+)
+
+// References to local files in an input document
+var fileRefPattern = regexp.MustCompile(`file://[^"'\s)<>]+`)
+
+// Flags that take values. Everything else starting with "--" is a switch.
+var valueArity = map[string]int{
+	"cookie":        2,
+	"custom-header": 2,
+	"post":          2,
+	"replace":       2,
+}
+
+var valueFlags = []string{
+	"allow", "cache-dir", "crop-h", "crop-w", "crop-x", "crop-y", "dpi", "encoding",
+	"format", "height", "image-dpi", "image-quality", "javascript-delay",
+	"load-error-handling", "load-media-error-handling", "margin-bottom",
+	"margin-left", "margin-right", "margin-top", "minimum-font-size",
+	"orientation", "page-height", "page-size", "page-width", "password",
+	"quality", "run-script", "title", "username", "width", "zoom",
+}
+
+func main() {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	args := os.Args[1:]
+
+	if path := os.Getenv("WKHTMLTOXTEST_LOG"); path != "" {
+		logInvocation(path, name, args)
+	}
+
+	for _, arg := range args {
+		switch arg {
+		case "--version", "-V":
+			version := os.Getenv("WKHTMLTOXTEST_VERSION")
+			if version == "" {
+				version = "0.12.6 (with patched qt)"
+			}
+			fmt.Printf("%s %s\n", name, version)
+			os.Exit(0)
+		case "--extended-help", "-H":
+			printHelp(name)
+			os.Exit(0)
+		}
+	}
+
+	flags, positional, err := parse(args)
+	if err != nil {
+		fail(1, "%v", err)
+	}
+
+	if len(positional) != 2 {
+		fail(1, "You need to specify at least one input file, and exactly one output file")
+	}
+	input, output := positional[0], positional[1]
+
+	if input == "-" {
+		io.Copy(io.Discard, os.Stdin)
+	}
+
+	fmt.Fprintln(os.Stderr, "Loading pages (1/6)")
+
+	switch input {
+	case networkErrorURL:
+		fail(1, "Error: Failed loading page %s (sometimes it will work just to ignore this error with --load-error-handling ignore)\nExit with code 1 due to network error: HostNotFoundError", input)
+	case hangURL:
+		for {
+			time.Sleep(time.Hour)
+		}
+	case warningURL:
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load %smissing.png (ignore)\n", input)
+	case crashURL:
+		write(output, []byte("%PDF-1.4\n"))
+		p, _ := os.FindProcess(os.Getpid())
+		p.Signal(syscall.SIGSEGV)
+		time.Sleep(time.Second)
+		os.Exit(139)
+	}
+
+	if _, disabled := flags["disable-local-file-access"]; disabled {
+		if path, blocked := blockedFile(input, flags["allow"]); blocked {
+			fail(1, "Warning: Blocked access to file %s\nError: Failed loading page file://%s\nExit with code 1 due to network error: ContentAccessDenied", path, path)
+		}
+	}
+
+	var data []byte
+	if name == "wkhtmltoimage" {
+		data, err = renderImage(flags, output)
+	} else {
+		data = renderPDF(flags)
+	}
+	if err != nil {
+		fail(1, "%v", err)
+	}
+
+	write(output, data)
+	fmt.Fprintln(os.Stderr, "Done")
+}
+
+// Switches listed by --extended-help, besides valueFlags and valueArity
+var switches = []string{
+	"custom-header-propagation", "no-custom-header-propagation",
+	"debug-javascript", "no-debug-javascript", "disable-external-links",
+	"enable-external-links", "disable-forms", "enable-forms", "grayscale",
+	"images", "no-images", "disable-internal-links", "enable-internal-links",
+	"disable-javascript", "enable-javascript", "lowquality",
+	"no-pdf-compression", "disable-smart-width", "enable-smart-width",
+	"stop-slow-scripts", "no-stop-slow-scripts", "transparent",
+	"use-xserver", "enable-smart-shrinking", "disable-smart-shrinking",
+	"footer-center", "header-center", "outline", "no-outline", "toc",
+	"enable-local-file-access", "disable-local-file-access",
+}
+
+// Flags the real converters mark as needing patched Qt
+var patchedQtFlags = []string{
+	"disable-external-links", "disable-internal-links", "disable-smart-shrinking",
+	"enable-external-links", "enable-internal-links", "enable-smart-shrinking",
+	"footer-center", "header-center", "outline", "no-outline", "toc",
+	"use-xserver",
+}
+
+func printHelp(name string) {
+	fmt.Printf("Name:\n  %s - html to pdf/image converter\n\nOptions:\n", name)
+	fmt.Println("  -H, --extended-help                 Display more extensive help")
+	fmt.Println("  -V, --version                       Output version information and exit")
+
+	var all []string
+	all = append(all, valueFlags...)
+	for key := range valueArity {
+		all = append(all, key)
+	}
+	all = append(all, switches...)
+
+	for _, flag := range all {
+		marker := ""
+		for _, p := range patchedQtFlags {
+			if p == flag {
+				marker = " *"
+			}
+		}
+		fmt.Printf("      --%s%s                 Option %s\n", flag, marker, flag)
+	}
+
+	fmt.Println("\nItems marked * are only available using patched QT.")
+}
+
+func parse(args []string) (map[string][]string, []string, error) {
+	flags := make(map[string][]string)
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-" || !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		key := strings.TrimLeft(arg, "-")
+		n := valueArity[key]
+		for _, f := range valueFlags {
+			if f == key {
+				n = 1
+			}
+		}
+
+		if i+n >= len(args) {
+			return nil, nil, fmt.Errorf("Missing argument for %s", arg)
+		}
+		flags[key] = append(flags[key], args[i+1:i+1+n]...)
+		i += n
+	}
+
+	return flags, positional, nil
+}
+
+// blockedFile returns the first file:// reference in the local file input
+// that is outside the allowed directories
+func blockedFile(input string, allowed []string) (string, bool) {
+	data, err := os.ReadFile(strings.TrimPrefix(input, "file://"))
+	if err != nil {
+		return "", false
+	}
+
+	for _, ref := range fileRefPattern.FindAllString(string(data), -1) {
+		path := filepath.Clean(strings.TrimPrefix(ref, "file://"))
+		inside := false
+		for _, dir := range allowed {
+			if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				inside = true
+			}
+		}
+		if !inside {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+func flagInt(flags map[string][]string, key string, fallback int) int {
+	if v, ok := flags[key]; ok {
+		if n, err := strconv.Atoi(v[0]); err == nil {
+			return n
+		}
+	}
+
+	return fallback
+}
+
+func renderImage(flags map[string][]string, output string) ([]byte, error) {
+	width := flagInt(flags, "width", 1024)
+	height := flagInt(flags, "height", 768)
+	if w := flagInt(flags, "crop-w", 0); w > 0 {
+		width = w
+	}
+	if h := flagInt(flags, "crop-h", 0); h > 0 {
+		height = h
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+	if f, ok := flags["format"]; ok {
+		format = strings.ToLower(f[0])
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpg", "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	default:
+		err = png.Encode(&buf, img)
+	}
+
+	return buf.Bytes(), err
+}
+
+func renderPDF(flags map[string][]string) []byte {
+	title := "fake"
+	if t, ok := flags["title"]; ok {
+		title = t[0]
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (wkhtmltoxtest) /CreationDate (D:%sZ) >>", escapePDFString(title), time.Now().UTC().Format("20060102150405")),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	// Like the real converters, every render is dated and has its own ID
+	id := make([]byte, 16)
+	rand.Read(id)
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R /ID [<%x> <%x>] >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, id, id, xref)
+
+	return buf.Bytes()
+}
+
+func escapePDFString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+
+	return r.Replace(s)
+}
+
+func write(output string, data []byte) {
+	if output == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fail(1, "%v", err)
+	}
+}
+
+func logInvocation(path string, name string, args []string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	json.NewEncoder(f).Encode(append([]string{name}, args...))
+}
+
+func fail(code int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(code)
+}